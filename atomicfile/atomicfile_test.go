@@ -0,0 +1,40 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "state", "session.json")
+	for _, s := range []string{`{"minutes":60}`, `{}`} {
+		if err := WriteFile(file, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != s {
+			t.Errorf("read %q, want %q", b, s)
+		}
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", fi.Mode().Perm())
+	}
+	// No temporary files are left behind
+	files, err := ioutil.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files in directory, want 1", len(files))
+	}
+}
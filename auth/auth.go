@@ -0,0 +1,27 @@
+// Package auth authenticates library patrons, either through the Mycel API
+// or directly against the library system.
+package auth
+
+import "context"
+
+// Response is the result of authenticating a user, matching the JSON
+// response from the Mycel api/users/authenticate.
+type Response struct {
+	Age           int // UnknownAge if the backend doesn't know it
+	Authenticated bool
+	Message       string
+	Minutes       int
+	Type          string
+	PrintQuota    *int `json:"print_quota"` // pages the user may print, if limited
+}
+
+// UnknownAge is the age of users whose age isn't known, so that age limits
+// can't be checked.
+const UnknownAge = -1
+
+// Authenticator checks a user's credentials. The error is only non-nil when
+// the backend can't be reached in time or gives an invalid response; wrong
+// credentials are reported with Authenticated false.
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*Response, error)
+}
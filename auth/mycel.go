@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mycel authenticates users through the Mycel API, which proxies the
+// library system and keeps track of the users' minutes.
+type Mycel struct {
+	HostAPI string
+}
+
+// Authenticate returns a user struct response from the mycel API
+// given a username and password
+func (m *Mycel) Authenticate(ctx context.Context, username, password string) (r *Response, err error) {
+	u := m.HostAPI + "/api/users/authenticate"
+	form := url.Values{"username": {username}, "password": {password}}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	r = new(Response)
+	err = json.NewDecoder(resp.Body).Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sip2Server is a stand-in SIP2 server, answering login (93) and patron
+// information (63) requests.
+type sip2Server struct {
+	ln       net.Listener
+	requests chan string
+	patron   string // variable length fields of the 64 response
+	detect   bool
+	corrupt  bool // send a bad checksum
+}
+
+// start starts the server, with the settings in s.
+func (s *sip2Server) start(t *testing.T) *sip2Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ln = ln
+	s.requests = make(chan string, 10)
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *sip2Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sip2Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		req, err := r.ReadString('\r')
+		if err != nil {
+			return
+		}
+		req = strings.TrimSuffix(req, "\r")
+		s.requests <- req
+
+		var resp string
+		switch req[:2] {
+		case "93":
+			resp = "941"
+		case "63":
+			resp = "64" + strings.Repeat(" ", 14) + "000" + sip2Date(time.Now()) + strings.Repeat("0000", 6) + s.patron
+		default:
+			resp = "96"
+		}
+		if s.detect {
+			resp += "AY0AZ"
+			if s.corrupt {
+				resp += "0000"
+			} else {
+				resp += sip2Checksum(resp)
+			}
+		}
+		conn.Write([]byte(resp + "\r"))
+	}
+}
+
+func TestSIP2Checksum(t *testing.T) {
+	// The checksum is the two's complement of the sum of the characters
+	msg := "9300CNkiosk|COsecret|CPbranch|AY0AZ"
+	sum, err := strconv.ParseUint(sip2Checksum(msg), 16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(msg); i++ {
+		sum += uint64(msg[i])
+	}
+	if uint16(sum) != 0 {
+		t.Errorf("checksum %s of %q doesn't add up to 0", sip2Checksum(msg), msg)
+	}
+}
+
+func TestSIP2Authenticate(t *testing.T) {
+	srv := (&sip2Server{patron: "AOinst|AA12345|AEOla Nordmann|BLY|CQY|PB20000102|", detect: true}).start(t)
+	s := &SIP2{
+		Addr:           srv.ln.Addr().String(),
+		LoginUser:      "kiosk",
+		LoginPassword:  "secret",
+		Location:       "branch",
+		Institution:    "inst",
+		Minutes:        60,
+		ErrorDetection: true,
+	}
+	r, err := s.Authenticate(context.Background(), "12345", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := <-srv.requests
+	if want := "9300CNkiosk|COsecret|CPbranch|AY0AZ"; !strings.HasPrefix(login, want) {
+		t.Errorf("login request = %q, want prefix %q", login, want)
+	}
+	info := <-srv.requests
+	if !strings.HasPrefix(info, "63001") || !strings.Contains(info, "          AOinst|AA12345|AC|AD1234|AY1AZ") {
+		t.Errorf("patron information request = %q", info)
+	}
+	for _, req := range []string{login, info} {
+		z := strings.LastIndex(req, "AZ")
+		if sum := sip2Checksum(req[:z+2]); req[z+2:] != sum {
+			t.Errorf("request %q has checksum %s, want %s", req, req[z+2:], sum)
+		}
+	}
+
+	if !r.Authenticated || r.Minutes != 60 {
+		t.Errorf("got %+v, want authenticated with 60 minutes", r)
+	}
+	if want := age(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), time.Now()); r.Age != want {
+		t.Errorf("age = %d, want %d", r.Age, want)
+	}
+}
+
+func TestSIP2Refused(t *testing.T) {
+	tests := []struct {
+		patron  string
+		message string
+	}{
+		{"AA12345|BLY|CQN|AFWrong PIN|", "Wrong PIN"},
+		{"AA12345|BLN|CQN|", "Feil lånenummer/brukernavn eller PIN/passord"},
+	}
+	for _, tt := range tests {
+		srv := (&sip2Server{patron: tt.patron}).start(t)
+		s := &SIP2{Addr: srv.ln.Addr().String(), Institution: "inst"}
+		r, err := s.Authenticate(context.Background(), "12345", "0000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Authenticated || r.Message != tt.message {
+			t.Errorf("%s: got %+v, want refused with %q", tt.patron, r, tt.message)
+		}
+		if req := <-srv.requests; !strings.HasPrefix(req, "63") {
+			t.Errorf("expected no login, got %q", req)
+		}
+	}
+}
+
+func TestSIP2UnknownAge(t *testing.T) {
+	srv := (&sip2Server{patron: "AA12345|BLY|CQY|"}).start(t)
+	s := &SIP2{Addr: srv.ln.Addr().String()}
+	r, err := s.Authenticate(context.Background(), "12345", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Authenticated || r.Age != UnknownAge {
+		t.Errorf("got %+v, want authenticated with unknown age", r)
+	}
+}
+
+func TestSIP2BadChecksum(t *testing.T) {
+	srv := (&sip2Server{patron: "AA12345|BLY|CQY|", detect: true, corrupt: true}).start(t)
+	s := &SIP2{Addr: srv.ln.Addr().String(), ErrorDetection: true}
+	if _, err := s.Authenticate(context.Background(), "12345", "1234"); err == nil {
+		t.Error("accepted a response with a bad checksum")
+	}
+}
+
+func TestSIP2Injection(t *testing.T) {
+	srv := (&sip2Server{patron: "AA12345|BLY|CQY|"}).start(t)
+	s := &SIP2{Addr: srv.ln.Addr().String(), Institution: "inst"}
+	inputs := []struct{ username, password string }{
+		{"12345|AD1234", "x"},
+		{"12345", "x|CQY"},
+		{"12345", "1234\r63001"},
+		{"12345\n", "1234"},
+	}
+	for _, in := range inputs {
+		r, err := s.Authenticate(context.Background(), in.username, in.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Authenticated || r.Message != sip2Refused {
+			t.Errorf("%q/%q: got %+v, want refused", in.username, in.password, r)
+		}
+	}
+
+	for _, s := range []*SIP2{
+		{Addr: srv.ln.Addr().String(), LoginUser: "kiosk|CPother", LoginPassword: "secret"},
+		{Addr: srv.ln.Addr().String(), LoginUser: "kiosk", LoginPassword: "secret\r"},
+		{Addr: srv.ln.Addr().String(), LoginUser: "kiosk", Location: "a|b"},
+		{Addr: srv.ln.Addr().String(), Institution: "inst|AA1"},
+	} {
+		if _, err := s.Authenticate(context.Background(), "12345", "1234"); err == nil {
+			t.Errorf("accepted settings %+v", s)
+		}
+	}
+
+	select {
+	case req := <-srv.requests:
+		t.Errorf("server got %q", req)
+	default:
+	}
+}
@@ -0,0 +1,237 @@
+// Package browser manages Firefox and Chromium through their enterprise
+// policy files, which the browsers read at startup and users can't change.
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/digibib/mycel-client/atomicfile"
+)
+
+// Policy is the browser setup from Mycel. URL patterns are given like in
+// Chromium's URLBlocklist, e.g. "example.com", which includes subdomains,
+// "https://example.com/path", or "*" for everything.
+type Policy struct {
+	Homepage    string   `json:"homepage"`
+	AllowedURLs []string `json:"allowed_urls"` // if set, all other sites are blocked
+	BlockedURLs []string `json:"blocked_urls"`
+	DownloadDir string   `json:"download_dir"`
+
+	DisablePasswordSaving  bool `json:"disable_password_saving"`
+	DisablePrivateBrowsing bool `json:"disable_private_browsing"`
+}
+
+// firefoxPatterns translates a URL pattern into Firefox WebsiteFilter match
+// patterns.
+func firefoxPatterns(pattern string) []string {
+	if pattern == "*" {
+		return []string{"<all_urls>"}
+	}
+	scheme, rest := "*", pattern
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		scheme, rest = pattern[:i], pattern[i+3:]
+	}
+	host, path := rest, "/*"
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+		if !strings.HasSuffix(path, "*") {
+			path += "*"
+		}
+	}
+	if strings.HasPrefix(host, "*.") || scheme == "file" {
+		return []string{scheme + "://" + host + path}
+	}
+	return []string{
+		scheme + "://" + host + path,
+		scheme + "://*." + host + path,
+	}
+}
+
+// validPattern checks a URL pattern.
+func validPattern(p string) error {
+	if p == "" || strings.ContainsAny(p, " \t\r\n\"") {
+		return errors.New("invalid URL pattern " + p)
+	}
+	return nil
+}
+
+// validate checks the policy.
+func (p Policy) validate() error {
+	if p.Homepage != "" {
+		u, err := url.Parse(p.Homepage)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("invalid homepage " + p.Homepage)
+		}
+	}
+	for _, list := range [][]string{p.AllowedURLs, p.BlockedURLs} {
+		for _, pattern := range list {
+			if err := validPattern(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	if p.DownloadDir != "" && !filepath.IsAbs(os.ExpandEnv(p.DownloadDir)) {
+		return errors.New("download directory must be an absolute path")
+	}
+	return nil
+}
+
+// Firefox returns the Firefox policies.json for p.
+func (p Policy) Firefox() map[string]interface{} {
+	policies := make(map[string]interface{})
+	if p.Homepage != "" {
+		policies["Homepage"] = map[string]interface{}{
+			"URL":       p.Homepage,
+			"Locked":    true,
+			"StartPage": "homepage",
+		}
+	}
+	block, allow := p.BlockedURLs, p.AllowedURLs
+	if len(allow) > 0 {
+		block = []string{"*"}
+	}
+	if len(block) > 0 {
+		filter := make(map[string]interface{})
+		var patterns []string
+		for _, b := range block {
+			patterns = append(patterns, firefoxPatterns(b)...)
+		}
+		filter["Block"] = patterns
+		patterns = nil
+		for _, a := range allow {
+			patterns = append(patterns, firefoxPatterns(a)...)
+		}
+		if len(patterns) > 0 {
+			filter["Exceptions"] = patterns
+		}
+		policies["WebsiteFilter"] = filter
+	}
+	if p.DownloadDir != "" {
+		policies["DownloadDirectory"] = os.ExpandEnv(p.DownloadDir)
+		policies["PromptForDownloadLocation"] = false
+	}
+	if p.DisablePasswordSaving {
+		policies["PasswordManagerEnabled"] = false
+		policies["OfferToSaveLogins"] = false
+	}
+	if p.DisablePrivateBrowsing {
+		policies["DisablePrivateBrowsing"] = true
+	}
+	return map[string]interface{}{"policies": policies}
+}
+
+// Chromium returns the Chromium managed policy file for p.
+func (p Policy) Chromium() map[string]interface{} {
+	policies := make(map[string]interface{})
+	if p.Homepage != "" {
+		policies["HomepageLocation"] = p.Homepage
+		policies["HomepageIsNewTabPage"] = false
+		policies["ShowHomeButton"] = true
+		policies["RestoreOnStartup"] = 4 // open a list of URLs
+		policies["RestoreOnStartupURLs"] = []string{p.Homepage}
+	}
+	block, allow := p.BlockedURLs, p.AllowedURLs
+	if len(allow) > 0 {
+		block = []string{"*"}
+		policies["URLAllowlist"] = allow
+	}
+	if len(block) > 0 {
+		policies["URLBlocklist"] = block
+	}
+	if p.DownloadDir != "" {
+		policies["DownloadDirectory"] = os.ExpandEnv(p.DownloadDir)
+		policies["PromptForDownload"] = false
+	}
+	if p.DisablePasswordSaving {
+		policies["PasswordManagerEnabled"] = false
+	}
+	if p.DisablePrivateBrowsing {
+		policies["IncognitoModeAvailability"] = 1 // disabled
+	}
+	return policies
+}
+
+// Apply writes the policy files for Firefox and Chromium. An empty file
+// name skips that browser. Unless sudo is empty, the files are first
+// written to firefox.json and chromium.json in the staging directory, and
+// then installed as root with sudo -n, so that they and their directories
+// stay owned by root. The staged and installed paths never change, so that
+// sudoers can allow exactly those commands. The download directory is
+// created if needed.
+func (p Policy) Apply(sudo, staging, firefoxFile, chromiumFile string) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if p.DownloadDir != "" {
+		if err := os.MkdirAll(os.ExpandEnv(p.DownloadDir), 0700); err != nil {
+			return err
+		}
+	}
+	if firefoxFile != "" {
+		staged := filepath.Join(staging, "firefox.json")
+		if err := writeJSON(sudo, staged, firefoxFile, p.Firefox()); err != nil {
+			return err
+		}
+	}
+	if chromiumFile != "" {
+		staged := filepath.Join(staging, "chromium.json")
+		if err := writeJSON(sudo, staged, chromiumFile, p.Chromium()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON atomically writes v to file, so that a browser starting
+// meanwhile never reads half a file. Without sudo, the file is written
+// directly. With sudo, v is written to staged, which is installed as root
+// next to file and then renamed over it, i.e.
+//
+//	sudo -n install -D -m 0644 staged file.new
+//	sudo -n mv -f file.new file
+func writeJSON(sudo, staged, file string, v interface{}) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if sudo == "" {
+		return atomicfile.WriteFile(file, b.Bytes(), 0644)
+	}
+
+	// The staging directory is only writable by the user, so the file
+	// can't be swapped by anyone else before it is installed
+	if err := os.MkdirAll(filepath.Dir(staged), 0700); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(staged, b.Bytes(), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(staged)
+	next := file + ".new"
+	if err := run(sudo, "install", "-D", "-m", "0644", staged, next); err != nil {
+		return err
+	}
+	return run(sudo, "mv", "-f", next, file)
+}
+
+// run runs a command with sudo -n, and returns its output in the error if
+// it fails.
+func run(sudo string, args ...string) error {
+	cmd := exec.Command(sudo, append([]string{"-n"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
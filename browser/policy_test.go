@@ -0,0 +1,89 @@
+package browser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	sudo, err := filepath.Abs("testdata/sudo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{
+		Homepage:    "https://bibliotek.example/",
+		AllowedURLs: []string{"bibliotek.example"},
+	}
+	for _, sudo := range []string{"", sudo} {
+		dir := t.TempDir()
+		staging := filepath.Join(dir, "staging")
+		firefox := filepath.Join(dir, "firefox/policies/policies.json")
+		chromium := filepath.Join(dir, "chromium/policies/managed/mycel.json")
+		log := filepath.Join(dir, "sudo.log")
+		os.Setenv("FAKE_SUDO_LOG", log)
+		t.Cleanup(func() { os.Unsetenv("FAKE_SUDO_LOG") })
+		if err := p.Apply(sudo, staging, firefox, chromium); err != nil {
+			t.Fatalf("sudo %q: %v", sudo, err)
+		}
+
+		// The commands run with sudo must be the same every time, for
+		// sudoers to allow
+		var want string
+		if sudo != "" {
+			want = "install -D -m 0644 " + staging + "/firefox.json " + firefox + ".new\n" +
+				"mv -f " + firefox + ".new " + firefox + "\n" +
+				"install -D -m 0644 " + staging + "/chromium.json " + chromium + ".new\n" +
+				"mv -f " + chromium + ".new " + chromium + "\n"
+		}
+		if b, _ := ioutil.ReadFile(log); string(b) != want {
+			t.Errorf("sudo %q: ran\n%s\nwant\n%s", sudo, b, want)
+		}
+		for _, name := range []string{"firefox.json", "chromium.json"} {
+			if _, err := os.Stat(filepath.Join(staging, name)); !os.IsNotExist(err) {
+				t.Errorf("sudo %q: staged %s left behind", sudo, name)
+			}
+		}
+		for file, want := range map[string]map[string]interface{}{firefox: p.Firefox(), chromium: p.Chromium()} {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare through JSON, as the numbers are decoded as float64
+			var got, wanted interface{}
+			wb, _ := json.Marshal(want)
+			json.Unmarshal(wb, &wanted)
+			if err := json.Unmarshal(b, &got); err != nil || !reflect.DeepEqual(got, wanted) {
+				t.Errorf("sudo %q: %s = %s, %v", sudo, file, b, err)
+			}
+			if fi, err := os.Stat(file); err != nil {
+				t.Error(err)
+			} else if fi.Mode().Perm() != 0644 {
+				t.Errorf("sudo %q: %s has mode %v, want 0644", sudo, file, fi.Mode().Perm())
+			}
+			if _, err := os.Stat(file + ".new"); !os.IsNotExist(err) {
+				t.Errorf("sudo %q: %s.new left behind", sudo, file)
+			}
+		}
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policies.json")
+	policies := []Policy{
+		{Homepage: "javascript:alert(1)"},
+		{BlockedURLs: []string{"two words"}},
+		{DownloadDir: "Downloads"},
+	}
+	for _, p := range policies {
+		if err := p.Apply("", "", file, ""); err == nil {
+			t.Errorf("applied invalid policy %+v", p)
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("invalid policy was written")
+	}
+}
@@ -0,0 +1,59 @@
+// Package cleanup wipes what a user leaves behind at log-off, so that the
+// next user starts afresh.
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Step is a single cleanup task.
+type Step struct {
+	Name string
+	Run  func() error
+}
+
+// Result is the outcome of a step, as reported to Mycel.
+type Result struct {
+	Step  string `json:"step"`
+	Error string `json:"error,omitempty"`
+}
+
+// Run runs the steps in order. A failing step doesn't stop the others.
+func Run(steps []Step) []Result {
+	var results []Result
+	for _, s := range steps {
+		start := time.Now()
+		r := Result{Step: s.Name}
+		if err := run(s); err != nil {
+			r.Error = err.Error()
+			log.Printf("cleanup: %s failed: %v", s.Name, err)
+		} else {
+			log.Printf("cleanup: %s done in %v", s.Name, time.Since(start).Round(time.Millisecond))
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// run runs a step, turning a panic into an error, so that the remaining
+// steps still run.
+func run(s Step) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.Run()
+}
+
+// OK reports whether all steps succeeded.
+func OK(results []Result) bool {
+	for _, r := range results {
+		if r.Error != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package cleanup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// setHome points HOME at a new temporary directory, and returns it.
+func setHome(t *testing.T) string {
+	home := t.TempDir()
+	old, ok := os.LookupEnv("HOME")
+	os.Setenv("HOME", home)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("HOME", old)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	})
+	return home
+}
+
+// writeFiles creates the files, relative to dir, with their names as
+// content.
+func writeFiles(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// tree lists the files and symbolic links below dir.
+func tree(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestInHome(t *testing.T) {
+	home := setHome(t)
+	for _, dir := range []string{
+		filepath.Join(home, "Downloads"),
+		filepath.Join(home, ".config/chromium"),
+		filepath.Join(home, "..downloads"),
+	} {
+		if err := inHome(dir); err != nil {
+			t.Errorf("inHome(%s) = %v", dir, err)
+		}
+	}
+	for _, dir := range []string{
+		home,
+		home + "/",
+		filepath.Dir(home),
+		"/etc",
+		"Downloads",
+		home + "/../etc",
+		home + "/Downloads/../..",
+		home + "-other/Downloads",
+	} {
+		if err := inHome(dir); err == nil {
+			t.Errorf("inHome(%s) accepted", dir)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	home := setHome(t)
+	dir := filepath.Join(home, "Downloads")
+	writeFiles(t, dir, "a.pdf", ".hidden", "sub/b.txt")
+	writeFiles(t, home, "keep.txt")
+	if err := os.Symlink(filepath.Join(home, "keep.txt"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Empty(dir); err != nil {
+		t.Fatal(err)
+	}
+	if files := tree(t, dir); len(files) != 0 {
+		t.Errorf("left %v", files)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("removed the directory itself: %v", err)
+	}
+	if files := tree(t, home); !reflect.DeepEqual(files, []string{"keep.txt"}) {
+		t.Errorf("home has %v, want only keep.txt", files)
+	}
+
+	// Missing directories are already empty
+	if err := Empty(filepath.Join(home, "missing")); err != nil {
+		t.Error(err)
+	}
+	if err := Empty(home); err == nil {
+		t.Error("emptied the home directory")
+	}
+	if err := Empty(filepath.Join(home, "..")); err == nil {
+		t.Error("emptied the parent of the home directory")
+	}
+	if files := tree(t, home); !reflect.DeepEqual(files, []string{"keep.txt"}) {
+		t.Errorf("home has %v, want only keep.txt", files)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	home := setHome(t)
+	skel := t.TempDir()
+	template := filepath.Join(skel, ".mozilla")
+	writeFiles(t, template, "firefox/profiles.ini", "firefox/default/prefs.js")
+	if err := os.Symlink("prefs.js", filepath.Join(template, "firefox/default/user.js")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(template, "firefox/profiles.ini"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(home, ".mozilla")
+	writeFiles(t, dir, "firefox/default/places.sqlite", "firefox/default/prefs.js")
+
+	if err := Restore(dir, template); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"firefox/default/prefs.js", "firefox/default/user.js", "firefox/profiles.ini"}
+	if files := tree(t, dir); !reflect.DeepEqual(files, want) {
+		t.Errorf("restored %v, want %v", files, want)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "firefox/default/user.js")); err != nil || link != "prefs.js" {
+		t.Errorf("symbolic link = %q, %v", link, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "firefox/profiles.ini")); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("profiles.ini has mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	// Without a template, the directory is removed
+	if err := Restore(dir, filepath.Join(skel, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%s not removed: %v", dir, err)
+	}
+
+	outside := t.TempDir()
+	writeFiles(t, outside, "important")
+	if err := Restore(outside, template); err == nil {
+		t.Error("restored a directory outside the home directory")
+	}
+	if err := Restore(filepath.Join(home, "../.."), template); err == nil {
+		t.Error("restored a directory outside the home directory")
+	}
+	if files := tree(t, outside); !reflect.DeepEqual(files, []string{"important"}) {
+		t.Errorf("outside directory has %v", files)
+	}
+}
@@ -0,0 +1,62 @@
+package cleanup
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mounts is the kernel's list of mounted filesystems.
+var mounts = "/proc/mounts"
+
+// removable reports whether the block device, e.g. /dev/sdb1, is on a
+// removable disk, like a USB stick or SD card.
+func removable(dev string) bool {
+	name := filepath.Base(dev)
+	// Partitions are listed under their disk in /sys/class/block, with
+	// the removable flag on the disk
+	link, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", name))
+	if err != nil {
+		return false
+	}
+	for _, dir := range []string{link, filepath.Dir(link)} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "removable")); err == nil {
+			return strings.TrimSpace(string(b)) == "1"
+		}
+	}
+	return false
+}
+
+// UnmountRemovable unmounts all removable media with udisksctl, which lets
+// the logged in user unmount what was mounted for it.
+func UnmountRemovable(udisksctl string) error {
+	f, err := os.Open(mounts)
+	if err != nil {
+		return err
+	}
+	var devices []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "/dev/") && removable(fields[0]) {
+			devices = append(devices, fields[0])
+		}
+	}
+	f.Close()
+
+	var failed []string
+	for _, dev := range devices {
+		output, err := exec.Command(udisksctl, "unmount", "--no-user-interaction", "-b", dev).CombinedOutput()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", dev, strings.TrimSpace(string(output))))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to unmount %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
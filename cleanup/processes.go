@@ -0,0 +1,161 @@
+package cleanup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// proc is where the kernel describes processes.
+var proc = "/proc"
+
+// clockTicks is the unit of process start times in /proc/PID/stat. It is
+// 100 on all common Linux platforms.
+const clockTicks = 100
+
+// process is a process of the current user.
+type process struct {
+	pid     int
+	ppid    int
+	started time.Time
+}
+
+// bootTime returns when the system was booted, from /proc/stat.
+func bootTime() (time.Time, error) {
+	f, err := os.Open(filepath.Join(proc, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if strings.HasPrefix(s.Text(), "btime ") {
+			secs, err := strconv.ParseInt(strings.TrimSpace(s.Text()[6:]), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("no btime in /proc/stat")
+}
+
+// processes lists the processes owned by the current user.
+func processes() ([]process, error) {
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return nil, err
+	}
+	uid := os.Getuid()
+	var procs []process
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if st, ok := e.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != uid {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(proc, e.Name(), "stat"))
+		if err != nil {
+			// The process has exited
+			continue
+		}
+		// The command name may contain spaces and parentheses, so the
+		// fields are counted from the last ')'
+		i := strings.LastIndex(string(b), ")")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(b)[i+1:])
+		// state ppid ... starttime is field 22, here index 19
+		if len(fields) < 20 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		ticks, _ := strconv.ParseInt(fields[19], 10, 64)
+		procs = append(procs, process{
+			pid:     pid,
+			ppid:    ppid,
+			started: boot.Add(time.Duration(ticks) * time.Second / clockTicks),
+		})
+	}
+	return procs, nil
+}
+
+// ancestors returns pid and its ancestors among procs. The chain ends at
+// init, or at the first ancestor owned by someone else.
+func ancestors(pid int, procs []process) map[int]bool {
+	parent := make(map[int]int)
+	for _, p := range procs {
+		parent[p.pid] = p.ppid
+	}
+	keep := make(map[int]bool)
+	for pid > 1 && !keep[pid] {
+		ppid, ok := parent[pid]
+		if !ok {
+			break
+		}
+		keep[pid] = true
+		pid = ppid
+	}
+	return keep
+}
+
+// KillSession terminates the user's processes started since the session
+// began, like browsers and office programs. Processes started before, like
+// the window manager, are left alone, as are this process and its
+// ancestors. Processes still running after grace are killed.
+func KillSession(since time.Time, grace time.Duration) error {
+	procs, err := processes()
+	if err != nil {
+		return err
+	}
+	keep := ancestors(os.Getpid(), procs)
+
+	var targets []int
+	for _, p := range procs {
+		// Start times are only precise to a tick
+		if !keep[p.pid] && !p.started.Before(since.Add(-time.Second)) {
+			targets = append(targets, p.pid)
+		}
+	}
+	for _, pid := range targets {
+		syscall.Kill(pid, syscall.SIGTERM)
+	}
+
+	deadline := time.Now().Add(grace)
+	for len(targets) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		targets = alive(targets)
+	}
+	for _, pid := range targets {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	if targets = alive(targets); len(targets) > 0 {
+		return fmt.Errorf("processes still running: %v", targets)
+	}
+	return nil
+}
+
+// alive returns the pids which are still running.
+func alive(pids []int) []int {
+	var left []int
+	for _, pid := range pids {
+		if syscall.Kill(pid, 0) == nil {
+			left = append(left, pid)
+		}
+	}
+	return left
+}
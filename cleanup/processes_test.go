@@ -0,0 +1,75 @@
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAncestors(t *testing.T) {
+	// init (1) -> display manager (500, root, so not listed) ->
+	// session (1000) -> terminal (1100) -> client (1200)
+	procs := []process{
+		{pid: 1000, ppid: 500},
+		{pid: 1100, ppid: 1000},
+		{pid: 1200, ppid: 1100},
+		{pid: 1300, ppid: 1200}, // a browser started by the client
+		{pid: 1400, ppid: 1000},
+	}
+	want := map[int]bool{1200: true, 1100: true, 1000: true}
+	if got := ancestors(1200, procs); !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors = %v, want %v", got, want)
+	}
+
+	// The chain stops at init, and at loops
+	procs = []process{{pid: 10, ppid: 1}, {pid: 20, ppid: 30}, {pid: 30, ppid: 20}}
+	if got := ancestors(10, procs); !reflect.DeepEqual(got, map[int]bool{10: true}) {
+		t.Errorf("ancestors = %v", got)
+	}
+	if got := ancestors(20, procs); !reflect.DeepEqual(got, map[int]bool{20: true, 30: true}) {
+		t.Errorf("ancestors = %v", got)
+	}
+}
+
+func TestProcesses(t *testing.T) {
+	dir := t.TempDir()
+	old := proc
+	proc = dir
+	defer func() { proc = old }()
+
+	write := func(file, s string) {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat := func(pid, ppid, ticks int, comm string) string {
+		// pid (comm) state ppid, then 16 fields up to starttime
+		return fmt.Sprintf("%d (%s) S %d 1 1 0 -1 4194560 100 0 0 0 10 5 0 0 20 0 1 0 %d 1000 100", pid, comm, ppid, ticks)
+	}
+	write("stat", "cpu  1 2 3\nbtime 1700000000\nprocesses 100\n")
+	write("1200/stat", stat(1200, 1100, 500, "mycel-client"))
+	write("1300/stat", stat(1300, 1200, 12345, "Web Content (pid) )"))
+	write("self/stat", stat(1200, 1100, 500, "mycel-client"))
+	write("1400/status", "no stat file, the process has exited")
+
+	procs, err := processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	boot := time.Unix(1700000000, 0)
+	want := []process{
+		{pid: 1200, ppid: 1100, started: boot.Add(5 * time.Second)},
+		{pid: 1300, ppid: 1200, started: boot.Add(123450 * time.Millisecond)},
+	}
+	if !reflect.DeepEqual(procs, want) {
+		t.Errorf("processes() = %v, want %v", procs, want)
+	}
+}
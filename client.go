@@ -2,32 +2,33 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"log/syslog"
 	"math"
 	"net/http"
 	"os"
 	"os/exec"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mattn/go-gtk/gdk"
 	"github.com/mattn/go-gtk/gtk"
-	"golang.org/x/net/websocket"
 
+	"github.com/digibib/mycel-client/browser"
+	"github.com/digibib/mycel-client/cleanup"
+	"github.com/digibib/mycel-client/display"
+	"github.com/digibib/mycel-client/idle"
+	"github.com/digibib/mycel-client/inventory"
+	"github.com/digibib/mycel-client/ipp"
+	"github.com/digibib/mycel-client/printing"
 	"github.com/digibib/mycel-client/window"
 )
 
-const DefaultMinutes = 60
-
 type response struct {
 	Client Client
 }
@@ -38,58 +39,45 @@ type Client struct {
 	Name      string
 	ScreenRes string `json:"screen_resolution"`
 	ShortTime bool
-	Options   options   `json:"options_inherited"`
-	Printers  []printer `json:"printers"`
-}
-
-// Printer struct to match JSON response from Mycel api/clients.
-type printer struct {
-	Id       int     `json:"id"`
-	Name     *string `json:"name"`
-	PPD      *string `json:"ppd_client"`
-	URI      *string `json:"uri_client"`
-	Location *string `json:"location"`
-	Info     *string `json:"info"`
-	Options  *string `json:"poptions"`
+	Options   options            `json:"options_inherited"`
+	Printers  []printing.Printer `json:"printers"`
 }
 
 // These fields must be pointers, in case of null value from JSON
 // When dereferencing check for nil pointers.
 type options struct {
-	Hours            *oh     `json:"opening_hours"`
-	AgeL             *int    `json:"age_limit_lower"`
-	AgeH             *int    `json:"age_limit_higher"`
-	Minutes          *int    `json:"time_limit"`
-	ShortTimeLimit   *int    `json:"shorttime_limit"`
-	Printer          *string `json:"printeraddr"`
+	Hours            *openingHours `json:"opening_hours"`
+	AgeL             *int          `json:"age_limit_lower"`
+	AgeH             *int          `json:"age_limit_higher"`
+	Minutes          *int          `json:"time_limit"`
+	ShortTimeLimit   *int          `json:"shorttime_limit"`
+	Printer          *string       `json:"printeraddr"`
 	Homepage         *string
-	DefaultPrinterId *int `json:"default_printer_id"`
+	DefaultPrinterId *int              `json:"default_printer_id"`
+	Displays         *display.Settings `json:"displays"`
+	Browser          *browser.Policy   `json:"browser"`
+	IdleLogoff       *int              `json:"idle_logoff"` // minutes
+	TimeExtension    *timeExtension    `json:"time_extension"`
 }
 
-// Client opening hours
-type oh struct {
-	MonOp *string `json:"monday_opens"`
-	MonCl *string `json:"monday_closes"`
-	MonX  *bool   `json:"monday_closed"`
-	TueOp *string `json:"tuesday_opens"`
-	TueCl *string `json:"tuesday_closes"`
-	TueX  *bool   `json:"tuesday_closed"`
-	SedOp *string `json:"wednsday_opens"`
-	WedCl *string `json:"wednsday_closes"`
-	WedX  *bool   `json:"wednsday_closed"`
-	ThuOp *string `json:"thursday_opens"`
-	ThuCl *string `json:"thursday_closes"`
-	ThuX  *bool   `json:"thursday_closed"`
-	FriOp *string `json:"friday_opens"`
-	FriCl *string `json:"friday_closes"`
-	FriX  *bool   `json:"friday_closed"`
-	SatOp *string `json:"saturday_opens"`
-	SatCl *string `json:"saturday_closes"`
-	SatX  *bool   `json:"saturday_closed"`
-	SunOp *string `json:"sunday_opens"`
-	SunCl *string `json:"sunday_closes"`
-	SunX  *bool   `json:"sunday_closed"`
-	Min   *int    `json:"minutes_before_closing"`
+// limits returns the time and age limits from the options. Limits which are
+// null in Mycel fall back to the default minutes from the configuration,
+// and to no age limit.
+func (o options) limits(cfg *config) (minutes, shortTimeLimit, agel, ageh int) {
+	minutes, shortTimeLimit, agel, ageh = cfg.DefaultMinutes, cfg.DefaultMinutes, 0, math.MaxInt32
+	if o.Minutes != nil {
+		minutes = *o.Minutes
+	}
+	if o.ShortTimeLimit != nil {
+		shortTimeLimit = *o.ShortTimeLimit
+	}
+	if o.AgeL != nil {
+		agel = *o.AgeL
+	}
+	if o.AgeH != nil {
+		ageh = *o.AgeH
+	}
+	return minutes, shortTimeLimit, agel, ageh
 }
 
 // logOnOffMessage represent JSON message to request user to log on/off client
@@ -99,10 +87,24 @@ type logOnOffMessage struct {
 	User   string `json:"user"`
 }
 
+// printJobMessage reports a finished print job to the Mycel server
+type printJobMessage struct {
+	Action  string       `json:"action"` // "print-job"
+	Client  int          `json:"client"`
+	User    string       `json:"user"`
+	Job     printing.Job `json:"job"`
+	Printed int          `json:"printed"` // pages printed in the session
+}
+
 // message struct represents all websocket JSON messages other than log-on message
 type message struct {
-	Status string  `json:"status"`
-	User   msgUser `json:"user"`
+	Status  string         `json:"status"`
+	User    msgUser        `json:"user"`
+	Command *command       `json:"command"`
+	Notice  *window.Notice `json:"notice"`
+
+	TimeResponse *timeResponse `json:"time_response"`
+	Waiting      *int          `json:"waiting"` // patrons waiting for a computer, in pings
 }
 
 type msgUser struct {
@@ -129,57 +131,126 @@ func identify(hostAPI, MAC string) (client *Client, err error) {
 	return &r.Client, nil
 }
 
-// connect logs on user. Blocks until successfull and
-// returns the websocket connection
-func connect(hostWS, username string, client int) (conn *websocket.Conn) {
-	// Request Mycel server to log in
-	for {
-		var err error
-		conn, err = websocket.Dial(fmt.Sprintf("%s/subscribe/clients/%d", hostWS, client), "", "http://localhost")
-		if err != nil {
-			fmt.Println("Can't connect to Mycel websocket server. Trying reconnect in 1 second...")
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		break
+func init() {
+	log.SetFlags(0)
+	syslogW, err := syslog.New(syslog.LOG_ERR, "mycel-client")
+	if err != nil {
+		log.Println("failed to initialize syslog writer: ", err)
+	} else {
+		log.SetOutput(io.MultiWriter(syslogW, os.Stderr))
+	}
+}
+
+// clientSpecs is posted to the Mycel api/client_specs at startup.
+type clientSpecs struct {
+	MAC string `json:"mac"`
+	inventory.Inventory
+}
+
+// idleCountdown is how long an idle user gets to confirm they are still
+// there before being logged off.
+const idleCountdown = 60 * time.Second
+
+// specsInterval is how often the hardware specs are checked for changes.
+const specsInterval = 15 * time.Minute
+
+// postSpecs posts the hardware specs to the Mycel api/client_specs, unless
+// they are the same as the last specs posted. It returns the specs posted,
+// or last if nothing was.
+func postSpecs(cfg *config, MAC string, last []byte) []byte {
+	inv := inventory.Read("/")
+	inv.ReadSerials("/", cfg.Sudo)
+	if cfg.Smartctl != "" {
+		inv.CheckHealth(cfg.Sudo, cfg.Smartctl)
 	}
-	// Create and send log-on request
-	logonMsg := logOnOffMessage{Action: "log-on", Client: client, User: username}
-	err := websocket.JSON.Send(conn, logonMsg)
+	if cfg.ImageVersion != "" {
+		inv.ReadImageVersion(cfg.ImageVersion)
+	}
+	specs, err := json.Marshal(clientSpecs{MAC: MAC, Inventory: inv})
+	if err != nil || bytes.Equal(specs, last) {
+		return last
+	}
+
+	url := fmt.Sprintf("%s/api/client_specs", cfg.API)
+	resp, err := http.Post(url, "application/json; charset=utf-8", bytes.NewReader(specs))
 	if err != nil {
-		fmt.Println("Couldn't send message " + err.Error())
+		log.Println("Failed to post hw specs: ", err)
+		return last
 	}
-	// Wait for "logged-on" confirmation
-	var msg message
-	for {
-		err := websocket.JSON.Receive(conn, &msg)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			fmt.Println("Couldn't receive msg " + err.Error())
-		}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Println("Failed to post hw specs: ", resp.Status)
+		return last
+	}
+	return specs
+}
 
-		if msg.Status == "logged-on" {
-			break
-		}
+// setBrowserPolicy writes the browser policy files, so that the browsers
+// started in the session use the latest settings.
+func setBrowserPolicy(cfg *config, client *Client) {
+	var policy browser.Policy
+	if client.Options.Browser != nil {
+		policy = *client.Options.Browser
+	}
+	if policy.Homepage == "" && client.Options.Homepage != nil {
+		policy.Homepage = *client.Options.Homepage
+	}
+	if err := policy.Apply(cfg.Sudo, cfg.PolicyStaging, cfg.FirefoxPolicies, cfg.ChromiumPolicies); err != nil {
+		log.Println("failed to set browser policies: ", err)
 	}
-	return
 }
 
-func init() {
-	log.SetFlags(0)
-	syslogW, err := syslog.New(syslog.LOG_ERR, "mycel-client")
+// displayReport is posted to the Mycel api/client_displays after the
+// displays are set up.
+type displayReport struct {
+	MAC string `json:"mac"`
+	display.Result
+}
+
+// setDisplays sets up the resolution and layout of the displays, and
+// reports the outcome to Mycel.
+func setDisplays(cfg *config, client *Client, MAC string) {
+	if client.ScreenRes == "auto" && client.Options.Displays == nil {
+		// Leave the displays as X set them up
+		return
+	}
+	var settings display.Settings
+	if client.Options.Displays != nil {
+		settings = *client.Options.Displays
+	}
+	result := display.Apply(cfg.Xrandr, settings, client.ScreenRes)
+	if result.Error != "" {
+		log.Println("failed to set screen resolution: ", result.Error)
+	}
+	for _, o := range result.Outputs {
+		if o.Fallback {
+			log.Printf("display %s doesn't support %s, using %s", o.Name, o.Requested, o.Mode)
+		}
+	}
+
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(displayReport{MAC: MAC, Result: result})
+	url := fmt.Sprintf("%s/api/client_displays", cfg.API)
+	resp, err := http.Post(url, "application/json; charset=utf-8", b)
 	if err != nil {
-		log.Println("failed to initialize syslog writer: ", err)
+		log.Println("failed to report display setup: ", err)
 	} else {
-		log.SetOutput(io.MultiWriter(syslogW, os.Stderr))
+		resp.Body.Close()
 	}
 }
 
-func setPrinters(hostAPI, MAC string) {
+// printerReport is posted to the Mycel api/client_printers when the printers
+// set up on the client have changed.
+type printerReport struct {
+	MAC string `json:"mac"`
+	printing.Report
+}
+
+// setPrinters sets up the printers managed in Mycel, and removes those no
+// longer managed.
+func setPrinters(cfg *config, MAC string) {
 	// Reloads client info to catch any printer setting updates
-	url := fmt.Sprintf("%s/api/clients/?mac=%s", hostAPI, MAC)
+	url := fmt.Sprintf("%s/api/clients/?mac=%s", cfg.API, MAC)
 	resp, err := http.Get(url)
 	if err != nil {
 		log.Println("failed to reload client info: ", err)
@@ -198,80 +269,52 @@ func setPrinters(hostAPI, MAC string) {
 	}
 
 	var client *Client = &r.Client
+	lp := cfg.printerAdmin()
 
 	if client.Printers != nil {
-		for _, printer := range client.Printers {
-			pms := ""
-
-			if printer.Name != nil {
-				pms += " -p '" + *printer.Name + "' "
-			}
-
-			if printer.Options != nil {
-				pms += *printer.Options
-			}
-
-			if printer.PPD != nil {
-				pms += " -m '" + *printer.PPD + "'"
-			}
-
-			if printer.URI != nil {
-				pms += " -v '" + *printer.URI + "'"
-			}
-
-			if printer.Location != nil {
-				pms += " -L '" + *printer.Location + "'"
-			}
-
-			if printer.Info != nil {
-				pms += " -D '" + *printer.Info + "'"
-			}
-
-			fmt.Println(pms)
-			cmd := exec.Command("/bin/sh", "-c", "/usr/bin/sudo -n /usr/sbin/lpadmin"+pms)
-			output, err := cmd.CombinedOutput()
+		report := printing.Reconcile(lp, client.Printers, client.Options.DefaultPrinterId, cfg.PrintersState)
+		for name, err := range report.Failed {
+			log.Printf("failed to set up printer %s: %s", name, err)
+		}
+		if report.Changed() {
+			b := new(bytes.Buffer)
+			json.NewEncoder(b).Encode(printerReport{MAC: MAC, Report: report})
+			url := fmt.Sprintf("%s/api/client_printers", cfg.API)
+			resp, err := http.Post(url, "application/json; charset=utf-8", b)
 			if err != nil {
-				log.Println("failed to set network printer address:", string(output))
-			}
-
-			if client.Options.DefaultPrinterId != nil && printer.Id == *client.Options.DefaultPrinterId {
-				// set default
-				cmd := exec.Command("/bin/sh", "-c", "/usr/bin/sudo -n /usr/bin/lpoptions -d "+*printer.Name)
-				output, err := cmd.CombinedOutput()
-				if err != nil {
-					log.Println("failed to set default printer: ", string(output))
-				}
+				log.Println("failed to report printer changes: ", err)
+			} else {
+				resp.Body.Close()
 			}
 		}
 	} else if client.Options.Printer != nil { // this can be removed once the new scheme is fully established
-		cmd := exec.Command("/bin/sh", "-c", "/usr/bin/sudo -n /usr/sbin/lpadmin -p publikumsskriver -v "+*client.Options.Printer)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Println("failed to set network printer address:", string(output))
+		if err := printing.InstallLegacy(lp, *client.Options.Printer); err != nil {
+			log.Println("failed to set network printer address: ", err)
 		}
 	}
 }
 
 func main() {
-	hostAPI := flag.String("api", "http://mycel:9000", "mycel host (api)")
-	hostWS := flag.String("ws", "ws://mycel:9001", "mycel host (ws)")
-	flag.Parse()
+	cfg, err := loadConfig(os.Args)
+	if err != nil {
+		log.Fatal("invalid configuration: ", err)
+	}
+	cfg.logSettings()
 
-	// Get the Mac-address of client
-	//eth0, err := ioutil.ReadFile("/sys/class/net/enp0s3/address")
-	eth0, err := ioutil.ReadFile("/sys/class/net/eth0/address")
+	// Get the Mac-addresses which may identify the client
+	macs, err := candidateMACs(cfg)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("failed to find client MAC address: ", err)
 	}
-	MAC := strings.TrimSpace(string(eth0))
 
 	// Identify the client
 	var client *Client
+	var MAC string
 	for {
-		client, err = identify(*hostAPI, MAC)
+		client, MAC, err = identifyAny(cfg.API, macs)
 		if err != nil {
-			if err.Error() == "404 Not Found" {
-				log.Fatal("client MAC address not found in mycel DB: ", MAC)
+			if err == errUnknownClient {
+				log.Fatal("client MAC address not found in mycel DB: ", strings.Join(macs, ", "))
 			}
 			log.Println("Couldn't reach Mycel server. Trying again in 1 seconds...")
 			time.Sleep(1 * time.Second)
@@ -279,46 +322,22 @@ func main() {
 		}
 		break
 	}
+	log.Println("identified client by MAC address: ", MAC)
 
-	// Send hardware specs to server
-	commands := map[string]string{
-		"ram":             "-t 19 | grep 'Range Size:' | awk {'print $3'}",
-		"manufacturer":    "-t 1 | grep 'Manufacturer:' | cut -d':' -f2 | cut -c2-",
-		"product_name":    "-t 1 | grep 'Product Name:' | cut -d':' -f2 | cut -c2-",
-		"product_version": "-t 1 | grep 'Version:' | cut -d':' -f2 | cut -c2-",
-		"serial_number":   "-t 1 | grep 'Serial Number:' | cut -d':' -f2 | cut -c2-",
-		"uuid":            "-t 1 | grep 'UUID:' | cut -d':' -f2 | cut -c2-",
-		"cpu_family":      "-t 4 | grep 'Family:' | cut -d':' -f2 | cut -c2-",
-	}
-
-	sysinfo := map[string]string{}
-	sysinfo["mac"] = MAC
-
-	for key, params := range commands {
-		cmd := exec.Command("/bin/sh", "-c", "/usr/bin/sudo -n /usr/sbin/dmidecode "+params)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Println("failed to gather hw specs: ", string(output))
+	// Send hardware specs to server, and again whenever they change, e.g.
+	// when a monitor or card reader is replaced
+	go func() {
+		var sent []byte
+		for {
+			sent = postSpecs(cfg, MAC, sent)
+			time.Sleep(specsInterval)
 		}
-
-		sysinfo[key] = string(output)
-	}
-
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(sysinfo)
-
-	url := fmt.Sprintf("%s/api/client_specs", *hostAPI)
-	resp, err := http.Post(url, "application/json; charset=utf-8", b)
-	if err != nil {
-		log.Println("Failed to post hw specs")
-	}
-
-	resp.Body.Close()
+	}()
 
 	// Create thread to send live signals to server
 	ticker := time.NewTicker(5 * time.Minute)
 	quit := make(chan struct{})
-	keep_alive := fmt.Sprintf("%s/api/keep_alive/?mac=%s", *hostAPI, MAC)
+	keep_alive := fmt.Sprintf("%s/api/keep_alive/?mac=%s", cfg.API, MAC)
 
 	go func() {
 		for {
@@ -339,135 +358,354 @@ func main() {
 
 	// Do local modifications to the client's environment
 
-	// 1. Screen Resolution
-	if client.ScreenRes != "auto" {
-		xrandr, err := exec.Command("/usr/bin/xrandr").Output()
-		if err != nil {
-			log.Println("failed to run xrandr", err)
-		}
-		rgx := regexp.MustCompile(`([\w]+)\sconnected`)
-		display := rgx.FindSubmatch(xrandr)[1]
-		cmd := exec.Command("/bin/sh", "-c", "/usr/bin/xrandr --output "+string(display)+" --mode "+client.ScreenRes)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Println("failed to set screen resolution: ", string(output))
-		}
+	// 1. Screen resolution and layout
+	setDisplays(cfg, client, MAC)
+
+	// loadHours gets the opening hours from the client API response, with
+	// any holidays or other exceptions applied
+	loadHours := func() *openingHours {
+		exceptions := loadExceptions(cfg.API, MAC, cfg.ExceptionsCache, cfg.ExceptionsFile)
+		return client.Options.Hours.withExceptions(exceptions)
 	}
 
-	// 2. Firefox homepage
-	if client.Options.Homepage != nil {
-		escHomepage := strings.Replace(*client.Options.Homepage, `/`, `\/`, -1)
+	var user, userType string
+	var hours *openingHours
+	var clock *sessionClock
+	var jobs *printing.Tracker
+	cups := &ipp.Client{Addr: cfg.CUPS}
+
+	// Connect to the Mycel websocket server, and carry out commands from
+	// staff until someone logs on
+	ws := newLink(cfg.WS, client.Id)
+	go ws.run()
+	stopLogin := make(chan struct{})
+	loginStopped := make(chan struct{})
+	go func() {
+		defer close(loginStopped)
+		for {
+			select {
+			case msg := <-ws.messages:
+				switch {
+				case msg.Command != nil:
+					handleCommand(cfg, MAC, ws, *msg.Command, nil)
+				case msg.Notice != nil:
+					showNotice(ws, *msg.Notice)
+				}
+			case <-stopLogin:
+				return
+			}
+		}
+	}()
 
-		sed := `/bin/sed -i 's/user_pref("browser.startup.homepage",.*/user_pref("browser.startup.homepage","` +
-			escHomepage + `");/' $HOME/.mozilla/firefox/*.default/prefs.js`
-		cmd := exec.Command("/bin/sh", "-c", sed)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Println("failed to set Firefox startpage: ", string(output))
+	// Resume the session if the client was restarted in the middle of it,
+	// or make sure the server logs off the user if it has expired meanwhile
+	saved, err := readSession(cfg.SessionFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("failed to read saved session: ", err)
+	}
+	if saved != nil && saved.Client == client.Id {
+		now := time.Now()
+		hours = loadHours()
+		clock = saved.clock()
+		if clock.left(now) > 0 && hours.isOpen(now) {
+			user, userType = saved.User, saved.UserType
+			jobs = saved.jobs(cups)
+			log.Printf("resuming session for %s with %d minutes left", user, clock.left(now))
+		} else {
+			log.Printf("session for %s expired while client was down, logging off", saved.User)
+			ws.send(logOnOffMessage{Action: "log-off", Client: client.Id, User: saved.User})
+			clock = nil
+		}
+	}
+	if clock == nil {
+		if err := removeSession(cfg.SessionFile); err != nil {
+			log.Println("failed to remove saved session: ", err)
 		}
 	}
 
-	// Get today's closing time from client API response
-	var hm string
-	now := time.Now()
-	switch now.Weekday() {
-	case time.Monday:
-		hm = *client.Options.Hours.MonCl
-	case time.Tuesday:
-		hm = *client.Options.Hours.TueCl
-	case time.Wednesday:
-		hm = *client.Options.Hours.WedCl
-	case time.Thursday:
-		hm = *client.Options.Hours.ThuCl
-	case time.Friday:
-		hm = *client.Options.Hours.FriCl
-	case time.Saturday:
-		hm = *client.Options.Hours.SatCl
-	case time.Sunday:
-		hm = *client.Options.Hours.SunCl
-	}
-
-	// Convert closing time to datetime
-	hour, _ := strconv.Atoi(hm[0:2])
-	min, _ := strconv.Atoi(hm[3:])
-	closingTime := time.Date(now.Year(), now.Month(), now.Day(), hour, min-*client.Options.Hours.Min, 0, 0, time.Local)
-
-	// Show login screen
+	// Show login screen, or the closed screen outside opening hours
+	authenticator := cfg.authenticator()
 	gtk.Init(nil)
-	var user, userType string
-	var userMinutes, extraMinutes int
-	if client.ShortTime {
-		userMinutes = *client.Options.ShortTimeLimit
-		extraMinutes = 0
-		user = window.ShortTime(client.Name, userMinutes)
-	} else {
-		extraMinutes = *client.Options.Minutes - DefaultMinutes
-		user, userMinutes, userType = window.Login(*hostAPI, client.Name, extraMinutes, *client.Options.AgeL, *client.Options.AgeH)
-		if userType == "G" {
-			// If guest user, minutes is user.minutes left or the minutes limit on the client
-			tempMinutes := int(math.Min(float64(userMinutes), float64(*client.Options.Minutes)))
-			extraMinutes = tempMinutes - userMinutes
+	for user == "" {
+		now := time.Now()
+		hours = loadHours()
+		closingTime, closes := hours.closingTime(now)
+		if !hours.isOpen(now) || (closes && closingTime.Sub(now) < time.Minute) {
+			from := now
+			if closes {
+				from = closingTime
+			}
+			opens, _ := hours.nextOpening(from)
+			window.Closed(client.Name, opens)
+
+			// Reload client info to catch any changes to the opening hours
+			if c, err := identify(cfg.API, MAC); err == nil {
+				client = c
+			}
+			continue
+		}
+
+		var userMinutes, extraMinutes int
+		var printQuota *int
+		minutes, shortTimeLimit, agel, ageh := client.Options.limits(cfg)
+		if client.ShortTime {
+			userMinutes = shortTimeLimit
+			extraMinutes = 0
+			user = window.ShortTime(client.Name, userMinutes, closingTime)
+		} else {
+			extraMinutes = minutes - cfg.DefaultMinutes
+			user, userMinutes, userType, printQuota = window.Login(authenticator, client.Name, extraMinutes, agel, ageh, closingTime)
+			if userType == "G" {
+				// If guest user, minutes is user.minutes left or the minutes limit on the client
+				tempMinutes := int(math.Min(float64(userMinutes), float64(minutes)))
+				extraMinutes = tempMinutes - userMinutes
+			}
 		}
+		clock = newSessionClock(userMinutes, extraMinutes)
+		jobs = &printing.Tracker{Client: cups, Quota: printQuota, Since: time.Now()}
 	}
 
-	// Calculate how long until closing time.
 	// Adjust minutes acording to closing hours, so that maximum minutes does
 	// not exceed available minutes until closing
-	untilClose := int(closingTime.Sub(now).Minutes())
-	if userMinutes+extraMinutes > untilClose {
-		extraMinutes = untilClose - userMinutes
+	if closingTime, closes := hours.closingTime(time.Now()); closes {
+		clock.limit(time.Now(), closingTime)
+	}
+
+	// Log on user. If the Mycel server can't be reached, the log-on is
+	// delivered when the connection comes back.
+	close(stopLogin)
+	<-loginStopped
+	ws.logOn(user)
+
+	// Save the session, so that it can be resumed after a crash
+	saveSession := func() {
+		err := writeSession(cfg.SessionFile, newSessionState(client.Id, user, userType, clock, jobs))
+		if err != nil {
+			log.Println("failed to save session: ", err)
+		}
+	}
+	saveSession()
+
+	// User has logged - set browser policies and printers, and tag print
+	// jobs with the user
+	setBrowserPolicy(cfg, client)
+	setPrinters(cfg, MAC)
+	if err := printing.TagJobs(cfg.printerAdmin(), cfg.Lpoptions, user); err != nil {
+		log.Println("failed to tag print jobs with user: ", err)
 	}
 
 	// Show status window
-	conn := connect(*hostWS, user, client.Id)
-	// User has logged - set printers
-	setPrinters(*hostAPI, MAC)
 	gdk.ThreadsInit()
 	status := new(window.Status)
 
-	status.Init(client.Name, user, userMinutes+extraMinutes)
+	status.Init(client.Name, user, clock.left(time.Now()), jobs)
+	if pages, limited := jobs.Remaining(); limited {
+		status.SetPages(pages)
+	}
+	warnings, _ := cfg.warnings() // checked by loadConfig
+	closingTime, _ := hours.closingTime(time.Now())
+	status.SetWarnings(warnings, closingTime)
 	status.Show()
 	status.Move()
+	status.SetMinutes(clock.left(time.Now()))
+
+	// pollJobs reports finished print jobs to the server, and updates the
+	// print jobs and pages left in the status window
+	var pollErr string
+	pollJobs := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		finished, err := jobs.Poll(ctx)
+		if err != nil {
+			// Only log when the error changes, as CUPS may be down for long
+			if err.Error() != pollErr {
+				log.Println("failed to check print jobs: ", err)
+				pollErr = err.Error()
+			}
+			return
+		}
+		pollErr = ""
+		for _, job := range finished {
+			ws.send(printJobMessage{Action: "print-job", Client: client.Id, User: user, Job: job, Printed: jobs.Printed})
+		}
+		if len(finished) > 0 {
+			saveSession()
+		}
+		gdk.ThreadsEnter()
+		status.SetJobs(jobs.Jobs())
+		if pages, limited := jobs.Remaining(); limited {
+			status.SetPages(pages)
+		}
+		gdk.ThreadsLeave()
+	}
+
+	// Watch for idle users, if Mycel sets a limit
+	var idleMonitor *idle.Monitor
+	var idleLimit time.Duration
+	if client.Options.IdleLogoff != nil && *client.Options.IdleLogoff > 0 {
+		idleLimit = time.Duration(*client.Options.IdleLogoff) * time.Minute
+		if idleMonitor, err = idle.Open(); err != nil {
+			log.Println("failed to watch for idle users: ", err)
+		}
+	}
+
+	// Staff commands act on this session
+	remote := &commandSession{clock: clock, status: status, closes: closingTime}
+	if !client.ShortTime {
+		remote.authenticator = authenticator
+	}
+
+	// Let the user ask for more time, if enabled in Mycel. The requests are
+	// handled in the session goroutine.
+	var extensions *timeRequests
+	askForTime := make(chan struct{}, 1)
+	if client.Options.TimeExtension != nil && client.Options.TimeExtension.Minutes > 0 {
+		extensions = &timeRequests{rules: *client.Options.TimeExtension}
+		status.EnableTimeRequest(func() {
+			select {
+			case askForTime <- struct{}{}:
+			default:
+			}
+		})
+	}
 
 	// goroutine to check for websocket messages and update status window
-	// with number of minutes left
+	// with number of minutes left. The session clock keeps counting down
+	// while the server is unreachable.
+	stopSession := make(chan struct{})
+	sessionStopped := make(chan struct{})
 	go func() {
-		var msg message
+		defer close(sessionStopped)
+		countdown := time.NewTicker(1 * time.Minute)
+		finalCountdown := time.NewTicker(1 * time.Second)
+		printCheck := time.NewTicker(10 * time.Second)
+		defer countdown.Stop()
+		defer finalCountdown.Stop()
+		defer printCheck.Stop()
+		quit := false
+		var idleCheck <-chan time.Time
+		if idleMonitor != nil {
+			t := time.NewTicker(2 * time.Second)
+			defer t.Stop()
+			idleCheck = t.C
+		}
 		for {
-			err := websocket.JSON.Receive(conn, &msg)
-			if err != nil {
-				if err == io.EOF {
-					println("ws disconnected")
-					// reconnect
-					conn = connect(*hostWS, user, client.Id)
+			select {
+			case msg := <-ws.messages:
+				switch {
+				case msg.Command != nil:
+					handleCommand(cfg, MAC, ws, *msg.Command, remote)
+				case msg.Notice != nil:
+					showNotice(ws, *msg.Notice)
+					continue
+				case msg.TimeResponse != nil:
+					if extensions != nil {
+						gdk.ThreadsEnter()
+						extensions.answer(*msg.TimeResponse, remote)
+						gdk.ThreadsLeave()
+					}
+				case msg.Status == "ping":
+					clock.sync(msg.User.Minutes, time.Now())
+					if extensions != nil {
+						extensions.waiting = msg.Waiting
+					}
+				default:
+					continue
 				}
-				continue
-			}
-
-			if msg.Status == "ping" {
-				if msg.User.Minutes+extraMinutes <= 0 {
+			case <-countdown.C:
+				if extensions != nil {
+					gdk.ThreadsEnter()
+					extensions.expire(time.Now(), remote)
+					gdk.ThreadsLeave()
+				}
+			case <-askForTime:
+				gdk.ThreadsEnter()
+				extensions.request(ws, user, remote)
+				gdk.ThreadsLeave()
+			case now := <-finalCountdown.C:
+				// Count down the last seconds, and log off exactly when the
+				// time is up
+				end := clock.end()
+				gdk.ThreadsEnter()
+				if !now.Before(end) && !quit {
 					gtk.MainQuit()
+					quit = true
 				}
+				status.Countdown(end)
+				gdk.ThreadsLeave()
+				continue
+			case <-printCheck.C:
+				pollJobs()
+				continue
+			case <-idleCheck:
+				// Ask whether the user is still there, and take the question
+				// away again as soon as there is any input
+				idleFor := idleMonitor.Idle()
 				gdk.ThreadsEnter()
-				status.SetMinutes(msg.User.Minutes + extraMinutes)
+				if idleFor >= idleLimit {
+					status.AskPresence(idleCountdown)
+				} else {
+					status.DismissPresence()
+				}
 				gdk.ThreadsLeave()
+				continue
+			case <-stopSession:
+				return
+			}
+
+			saveSession()
+			minutes := clock.left(time.Now())
+			gdk.ThreadsEnter()
+			if minutes <= 0 && !quit {
+				gtk.MainQuit()
+				quit = true
 			}
+			status.SetMinutes(minutes)
+			gdk.ThreadsLeave()
 		}
 	}()
 
 	// This blocks until the 'logg out' button is clicked, or until the user
 	// has spent all minutes
 	gtk.Main()
+	close(stopSession)
+	<-sessionStopped
+	if idleMonitor != nil {
+		idleMonitor.Close()
+	}
 
-	// Send log-out message to server
-	logOffMsg := logOnOffMessage{Action: "log-off", Client: client.Id, User: user}
-	err = websocket.JSON.Send(conn, logOffMsg)
-	if err != nil {
-		// Don't bother to resend. Server will log off user anyway, when the
-		// connection is closed
+	// Report the last print jobs, and make sure held jobs aren't printed
+	// for the next user
+	pollJobs()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	jobs.CancelHeld(ctx)
+	cancel()
+	if err := printing.TagJobs(cfg.printerAdmin(), cfg.Lpoptions, ""); err != nil {
+		log.Println("failed to remove user from print jobs: ", err)
 	}
 
-	// Force session restart
-	cmd := exec.Command("/bin/sh", "-c", "/srv/pubterm/restart-session.sh")
-	err = cmd.Run()
+	// Send log-out message to server, then wipe what the user left behind
+	// and report how it went. Don't wait too long if the server is
+	// unreachable; it will log off the user anyway, when it notices the
+	// connection is gone.
+	ws.logOff()
+	results := cleanup.Run(cleanupSteps(cfg, jobs))
+	ws.send(cleanupMessage{Action: "cleanup", Client: client.Id, User: user, OK: cleanup.OK(results), Steps: results})
+	ws.close(10 * time.Second)
+	if err := removeSession(cfg.SessionFile); err != nil {
+		log.Println("failed to remove saved session: ", err)
+	}
+
+	// Reboot or shut down if staff asked to, or else restart the session
+	if remote.power != "" {
+		err := power(cfg, remote.power)
+		if err == nil {
+			return
+		}
+		log.Printf("failed to %s: %v", remote.power, err)
+	}
+	cmd := exec.Command(cfg.RestartScript)
+	if err := cmd.Run(); err != nil {
+		log.Printf("failed to run %s: %v", cfg.RestartScript, err)
+	}
 }
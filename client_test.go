@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestOptionLimits(t *testing.T) {
+	cfg := defaultConfig()
+	tests := []struct {
+		options                        string
+		minutes, shortTime, agel, ageh int
+	}{
+		{`{"time_limit": 90, "shorttime_limit": 15, "age_limit_lower": 13, "age_limit_higher": 19}`, 90, 15, 13, 19},
+		{`{"time_limit": null, "shorttime_limit": null, "age_limit_lower": null, "age_limit_higher": null}`, 60, 60, 0, math.MaxInt32},
+		{`{}`, 60, 60, 0, math.MaxInt32},
+	}
+	for _, tt := range tests {
+		var o options
+		if err := json.Unmarshal([]byte(tt.options), &o); err != nil {
+			t.Fatal(err)
+		}
+		minutes, shortTime, agel, ageh := o.limits(cfg)
+		if minutes != tt.minutes || shortTime != tt.shortTime || agel != tt.agel || ageh != tt.ageh {
+			t.Errorf("limits(%s) = %d, %d, %d, %d, want %d, %d, %d, %d", tt.options,
+				minutes, shortTime, agel, ageh, tt.minutes, tt.shortTime, tt.agel, tt.ageh)
+		}
+	}
+}
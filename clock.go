@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// staleAfter is how long the clock can go without hearing from the server
+// before it is considered to have been offline.
+const staleAfter = 3 * time.Minute
+
+// sessionClock keeps track of how many minutes a patron has left. Between
+// updates from the Mycel server it counts down locally, so that time keeps
+// running out even when the server is unreachable.
+type sessionClock struct {
+	mu      sync.Mutex
+	minutes int       // user minutes left according to the server, at synced
+	extra   int       // client specific adjustment, see extraMinutes in main
+	synced  time.Time // when minutes was last updated
+}
+
+func newSessionClock(minutes, extra int) *sessionClock {
+	return &sessionClock{minutes: minutes, extra: extra, synced: time.Now()}
+}
+
+// left returns the number of minutes left at time t.
+func (c *sessionClock) left(t time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.leftLocked(t)
+}
+
+func (c *sessionClock) leftLocked(t time.Time) int {
+	elapsed := int(t.Sub(c.synced).Minutes())
+	return c.minutes - elapsed + c.extra
+}
+
+// sync updates the clock with the user minutes reported by the server at
+// time t. After a period offline the server hasn't counted the time spent
+// offline, so the local figure wins if it is lower.
+func (c *sessionClock) sync(minutes int, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Sub(c.synced) > staleAfter {
+		if local := c.leftLocked(t); minutes+c.extra > local {
+			c.extra = local - minutes
+		}
+	}
+	c.minutes = minutes
+	c.synced = t
+}
+
+// limit reduces the minutes left at time t, so that they don't run past
+// until, e.g. the closing time.
+func (c *sessionClock) limit(t, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	untilMinutes := int(until.Sub(t).Minutes())
+	if left := c.leftLocked(t); left > untilMinutes {
+		c.extra -= left - untilMinutes
+	}
+}
+
+// add gives the user n more minutes, or takes n minutes away if negative.
+func (c *sessionClock) add(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extra += n
+}
+
+// end returns when the minutes run out, as things stand.
+func (c *sessionClock) end() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.synced.Add(time.Duration(c.minutes+c.extra) * time.Minute)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/auth"
+	"github.com/digibib/mycel-client/window"
+)
+
+// commandTypes lists the commands Mycel staff may send to a client. Only
+// those allowed by the remote-commands setting are carried out; by default
+// the privileged ones (reboot, shutdown and reload-config) are not.
+var commandTypes = []string{"logout", "add-minutes", "lock-screen", "message", "reboot", "shutdown", "reload-config"}
+
+// defaultCommands are the commands allowed unless configured otherwise.
+var defaultCommands = []string{"logout", "add-minutes", "lock-screen", "message"}
+
+// command is a request from Mycel staff, sent over the websocket as
+// {"status": "command", "command": {...}}.
+type command struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Minutes int    `json:"minutes,omitempty"` // add-minutes
+	Text    string `json:"text,omitempty"`    // message
+}
+
+// commandResult acknowledges a command.
+type commandResult struct {
+	Action string `json:"action"` // "command-result"
+	Client int    `json:"client"`
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+var errNoSession = errors.New("nobody is logged in")
+
+// commandSession is the session a command acts on. Only the GTK main loop
+// of the session may use the status window, so commands which do must be
+// run from the session goroutine.
+type commandSession struct {
+	clock         *sessionClock
+	closes        time.Time // when the library closes, or zero
+	status        *window.Status
+	authenticator auth.Authenticator // nil on short time clients
+
+	// power is the systemctl action, reboot or poweroff, to carry out once
+	// the user is logged off
+	power string
+}
+
+// addMinutes gives the user n more minutes, but not past closing time. The
+// GDK lock must be held.
+func (s *commandSession) addMinutes(n int) {
+	s.clock.add(n)
+	if !s.closes.IsZero() {
+		s.clock.limit(time.Now(), s.closes)
+	}
+	s.status.SetMinutes(s.clock.left(time.Now()))
+}
+
+// handleCommand carries out cmd if allowed, and reports the result to
+// Mycel. s is nil when nobody is logged in.
+func handleCommand(cfg *config, MAC string, ws *link, cmd command, s *commandSession) {
+	result := commandResult{Action: "command-result", Client: ws.client, ID: cmd.ID, Type: cmd.Type, OK: true}
+	if err := runCommand(cfg, MAC, ws, cmd, s); err != nil {
+		log.Printf("command %s %q failed: %v", cmd.Type, cmd.ID, err)
+		result.OK = false
+		result.Error = err.Error()
+	} else {
+		log.Printf("command %s %q done", cmd.Type, cmd.ID)
+	}
+	ws.send(result)
+}
+
+// runCommand carries out cmd. reload-config only sets up the displays,
+// browser policies and printers again; the client settings the session
+// runs with, like the time and age limits, opening hours and idle log-off,
+// are left as they were, and take effect when the client restarts after
+// log-off.
+func runCommand(cfg *config, MAC string, ws *link, cmd command, s *commandSession) error {
+	if !contains(commandTypes, cmd.Type) {
+		return fmt.Errorf("unknown command %q", cmd.Type)
+	}
+	if !contains(splitList(cfg.RemoteCommands), cmd.Type) {
+		return fmt.Errorf("command %q is not allowed on this client", cmd.Type)
+	}
+
+	switch cmd.Type {
+	case "reboot", "shutdown":
+		action := map[string]string{"reboot": "reboot", "shutdown": "poweroff"}[cmd.Type]
+		if s != nil {
+			// Log off the user the usual way first, so that the session is
+			// cleaned up and not resumed after the restart. main carries
+			// out the action when done.
+			gdk.ThreadsEnter()
+			s.power = action
+			gtk.MainQuit()
+			gdk.ThreadsLeave()
+			return nil
+		}
+		return power(cfg, action)
+	case "message":
+		if cmd.Text == "" {
+			return errors.New("no text given")
+		}
+		window.AddNotice(window.Notice{ID: cmd.ID, Text: cmd.Text, Severity: "info"}, nil)
+		return nil
+	case "reload-config":
+		// Set up again from the client settings in Mycel. The session
+		// keeps its own copy of the settings.
+		client, err := identify(cfg.API, MAC)
+		if err != nil {
+			return err
+		}
+		setDisplays(cfg, client, MAC)
+		setBrowserPolicy(cfg, client)
+		setPrinters(cfg, MAC)
+		return nil
+	}
+
+	// The rest act on the logged in user
+	if s == nil {
+		return errNoSession
+	}
+	gdk.ThreadsEnter()
+	defer gdk.ThreadsLeave()
+	switch cmd.Type {
+	case "logout":
+		gtk.MainQuit()
+	case "add-minutes":
+		if cmd.Minutes == 0 {
+			return errors.New("no minutes given")
+		}
+		s.addMinutes(cmd.Minutes)
+	case "lock-screen":
+		s.status.Lock(s.authenticator)
+	}
+	return nil
+}
+
+// power runs systemctl reboot or poweroff. systemctl returns as soon as the
+// job is queued, which leaves time to acknowledge the command.
+func power(cfg *config, action string) error {
+	output, err := exec.Command(cfg.Sudo, "-n", cfg.Systemctl, action).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// noticeAck reports that the user has read a notice.
+type noticeAck struct {
+	Action string `json:"action"` // "notice-ack"
+	Client int    `json:"client"`
+	User   string `json:"user"`
+	ID     string `json:"id"`
+}
+
+// showNotice shows a notice from staff, sent as {"status": "notice",
+// "notice": {...}}, and reports when the user has read it, if asked to.
+func showNotice(ws *link, n window.Notice) {
+	window.AddNotice(n, func() {
+		ws.send(noticeAck{Action: "notice-ack", Client: ws.client, User: ws.loggedOn(), ID: n.ID})
+	})
+}
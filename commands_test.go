@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gtk"
+	"golang.org/x/net/websocket"
+
+	"github.com/digibib/mycel-client/window"
+)
+
+// mycelServer is a stand-in Mycel server. It sends the commands given to it
+// over the websocket of client 7, and passes on the results.
+type mycelServer struct {
+	*httptest.Server
+	commands    chan command
+	results     chan commandResult
+	apiRequests int32
+}
+
+func newMycelServer(t *testing.T) *mycelServer {
+	s := &mycelServer{commands: make(chan command), results: make(chan commandResult, 10)}
+	mux := http.NewServeMux()
+	mux.Handle("/subscribe/clients/7", websocket.Handler(func(conn *websocket.Conn) {
+		go func() {
+			for {
+				var result commandResult
+				if err := websocket.JSON.Receive(conn, &result); err != nil {
+					return
+				}
+				s.results <- result
+			}
+		}()
+		for cmd := range s.commands {
+			cmd := cmd
+			if err := websocket.JSON.Send(conn, message{Status: "command", Command: &cmd}); err != nil {
+				return
+			}
+		}
+	}))
+	mux.HandleFunc("/api/clients/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.apiRequests, 1)
+		if r.URL.Query().Get("mac") != "00:11:22:33:44:55" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"client": {"id": 7, "name": "Test", "screen_resolution": "auto", "options_inherited": {}}}`))
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(s.commands)
+		s.Close()
+	})
+	return s
+}
+
+// testCommands sets up a configuration running the fake sudo and
+// systemctl in testdata, a Mycel server and a link to it. The returned
+// function sends a command, carries it out with handleCommand and returns
+// the result Mycel got. It may be called from other goroutines.
+func testCommands(t *testing.T, s *commandSession) (*config, *mycelServer, func(command) commandResult) {
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("FAKE_SYSTEMCTL_LOG", filepath.Join(t.TempDir(), "systemctl"))
+	t.Cleanup(func() { os.Unsetenv("FAKE_SYSTEMCTL_LOG") })
+
+	mycel := newMycelServer(t)
+	cfg := defaultConfig()
+	cfg.API = mycel.URL
+	cfg.Sudo = filepath.Join(dir, "sudo")
+	cfg.Systemctl = filepath.Join(dir, "systemctl")
+	cfg.FirefoxPolicies, cfg.ChromiumPolicies = "", ""
+	cfg.PrintersState = filepath.Join(t.TempDir(), "printers.json")
+
+	ws := newLink("ws"+strings.TrimPrefix(mycel.URL, "http"), 7)
+	go ws.run()
+	t.Cleanup(func() { ws.close(time.Second) })
+
+	return cfg, mycel, func(cmd command) commandResult {
+		mycel.commands <- cmd
+		msg := <-ws.messages
+		if msg.Command == nil {
+			t.Errorf("got %+v, want a command", msg)
+			return commandResult{}
+		}
+		handleCommand(cfg, "00:11:22:33:44:55", ws, *msg.Command, s)
+		select {
+		case result := <-mycel.results:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Errorf("no result for command %s", cmd.Type)
+			return commandResult{}
+		}
+	}
+}
+
+// systemctlRuns returns the systemctl commands run by the tests.
+func systemctlRuns(t *testing.T) []string {
+	b, err := ioutil.ReadFile(os.Getenv("FAKE_SYSTEMCTL_LOG"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestCommandsWithoutSession(t *testing.T) {
+	cfg, mycel, run := testCommands(t, nil)
+	cfg.RemoteCommands = strings.Join(commandTypes, ",")
+
+	tests := []struct {
+		cmd  command
+		err  string // "" if the command should succeed
+		runs []string
+	}{
+		{cmd: command{ID: "1", Type: "message", Text: "Biblioteket stenger om 15 minutter"}},
+		{cmd: command{ID: "2", Type: "message"}, err: "no text given"},
+		{cmd: command{ID: "3", Type: "logout"}, err: errNoSession.Error()},
+		{cmd: command{ID: "4", Type: "add-minutes", Minutes: 10}, err: errNoSession.Error()},
+		{cmd: command{ID: "5", Type: "lock-screen"}, err: errNoSession.Error()},
+		{cmd: command{ID: "6", Type: "format-disk"}, err: `unknown command "format-disk"`},
+		{cmd: command{ID: "7", Type: "reboot"}, runs: []string{"reboot"}},
+		{cmd: command{ID: "8", Type: "shutdown"}, runs: []string{"reboot", "poweroff"}},
+		{cmd: command{ID: "9", Type: "reload-config"}, runs: []string{"reboot", "poweroff"}},
+	}
+	for _, tt := range tests {
+		result := run(tt.cmd)
+		want := commandResult{Action: "command-result", Client: 7, ID: tt.cmd.ID, Type: tt.cmd.Type, OK: tt.err == "", Error: tt.err}
+		if result != want {
+			t.Errorf("%s: got %+v, want %+v", tt.cmd.Type, result, want)
+		}
+		if runs := systemctlRuns(t); strings.Join(runs, ",") != strings.Join(tt.runs, ",") {
+			t.Errorf("%s: systemctl ran %q, want %q", tt.cmd.Type, runs, tt.runs)
+		}
+	}
+	// reload-config identifies the client, and loads the printers
+	if n := atomic.LoadInt32(&mycel.apiRequests); n != 2 {
+		t.Errorf("reload-config made %d API requests, want 2", n)
+	}
+
+	cfg.Systemctl = "/bin/false"
+	if result := run(command{ID: "10", Type: "reboot"}); result.OK || result.Error == "" {
+		t.Errorf("failing reboot reported as %+v", result)
+	}
+}
+
+func TestCommandsAllowed(t *testing.T) {
+	cfg, mycel, run := testCommands(t, nil)
+	for _, typ := range []string{"reboot", "shutdown", "reload-config"} {
+		want := commandResult{Action: "command-result", Client: 7, ID: typ, Type: typ, Error: `command "` + typ + `" is not allowed on this client`}
+		if result := run(command{ID: typ, Type: typ}); result != want {
+			t.Errorf("got %+v, want %+v", result, want)
+		}
+	}
+	cfg.RemoteCommands = "lock-screen"
+	if result := run(command{ID: "m", Type: "message", Text: "Hei"}); result.OK {
+		t.Errorf("message allowed, got %+v", result)
+	}
+	if runs := systemctlRuns(t); runs != nil {
+		t.Errorf("systemctl ran %q", runs)
+	}
+	if n := atomic.LoadInt32(&mycel.apiRequests); n != 0 {
+		t.Errorf("made %d API requests", n)
+	}
+}
+
+// TestCommandsInSession carries out the commands acting on the logged in
+// user, which needs a display.
+func TestCommandsInSession(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("no display")
+	}
+	gdk.ThreadsInit()
+	gtk.Init(nil)
+	status := new(window.Status)
+	status.Init("Test", "12345", 30, nil)
+	s := &commandSession{clock: newSessionClock(30, 0), status: status}
+	cfg, _, run := testCommands(t, s)
+	cfg.RemoteCommands = strings.Join(commandTypes, ",")
+
+	if result := run(command{ID: "1", Type: "add-minutes", Minutes: 15}); !result.OK {
+		t.Errorf("add-minutes failed: %+v", result)
+	}
+	if left := s.clock.left(time.Now()); left != 45 {
+		t.Errorf("%d minutes left, want 45", left)
+	}
+	if result := run(command{ID: "2", Type: "add-minutes"}); result.OK || result.Error != "no minutes given" {
+		t.Errorf("add-minutes without minutes: %+v", result)
+	}
+	if result := run(command{ID: "3", Type: "lock-screen"}); !result.OK {
+		t.Errorf("lock-screen failed: %+v", result)
+	}
+
+	// Commands ending the session quit the main loop
+	for _, cmd := range []command{{ID: "4", Type: "logout"}, {ID: "5", Type: "reboot"}} {
+		results := make(chan commandResult, 1)
+		go func() { results <- run(cmd) }()
+		gtk.Main()
+		if result := <-results; !result.OK {
+			t.Errorf("%s failed: %+v", cmd.Type, result)
+		}
+	}
+	// The reboot waits for the log-off
+	if s.power != "reboot" {
+		t.Errorf("power action %q, want reboot", s.power)
+	}
+	if runs := systemctlRuns(t); runs != nil {
+		t.Errorf("systemctl ran %q during the session", runs)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/digibib/mycel-client/auth"
+	"github.com/digibib/mycel-client/ipp"
+	"github.com/digibib/mycel-client/printing"
+	"github.com/digibib/mycel-client/window"
+)
+
+// defaultConfigFile is read unless another file is given with -config or
+// MYCEL_CONFIG. It is fine for it not to exist.
+const defaultConfigFile = "/etc/mycel-client.json"
+
+// config holds the client settings. They are read from a JSON config file,
+// then from MYCEL_* environment variables, and finally from command line
+// flags, each overriding the previous.
+type config struct {
+	API              string
+	WS               string
+	Interface        string
+	MAC              string
+	Sudo             string
+	Lpadmin          string
+	Lpoptions        string
+	Lpstat           string
+	Smartctl         string
+	Xrandr           string
+	Udisksctl        string
+	Systemctl        string
+	RestartScript    string
+	ImageVersion     string
+	FirefoxPolicies  string
+	ChromiumPolicies string
+	PolicyStaging    string
+	Cleanup          string
+	CleanupWipe      string
+	CleanupRestore   string
+	RemoteCommands   string
+	Warnings         string
+	DefaultMinutes   int
+	ExceptionsFile   string
+	ExceptionsCache  string
+	SessionFile      string
+	PrintersState    string
+	Printing         string
+	CUPS             string
+	Auth             string
+	SIP2Addr         string
+	SIP2User         string
+	SIP2Password     string
+	SIP2Location     string
+	SIP2Institution  string
+	SIP2Checksums    bool
+}
+
+// setting describes a single config field. The name is used as flag name;
+// the JSON key and environment variable are derived from it, e.g.
+// "exceptions-cache" is read from "exceptions_cache" in the config file
+// and from MYCEL_EXCEPTIONS_CACHE.
+type setting struct {
+	name  string
+	value interface{} // *string, *int or *bool
+	usage string
+}
+
+func (s setting) key() string {
+	return strings.Replace(s.name, "-", "_", -1)
+}
+
+func (s setting) env() string {
+	return "MYCEL_" + strings.ToUpper(s.key())
+}
+
+// set parses and stores a string value.
+func (s setting) set(v string) error {
+	switch p := s.value.(type) {
+	case *string:
+		*p = v
+	case *int:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.name, err)
+		}
+		*p = i
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.name, err)
+		}
+		*p = b
+	}
+	return nil
+}
+
+// String formats the current value.
+func (s setting) String() string {
+	switch p := s.value.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	}
+	return ""
+}
+
+// settings lists all the fields of c.
+func (c *config) settings() []setting {
+	return []setting{
+		{"api", &c.API, "mycel host (api)"},
+		{"ws", &c.WS, "mycel host (ws)"},
+		{"interface", &c.Interface, "network interface identifying the client (default: discover)"},
+		{"mac", &c.MAC, "MAC address identifying the client (default: from interface)"},
+		{"sudo", &c.Sudo, "path to sudo"},
+		{"lpadmin", &c.Lpadmin, "path to lpadmin"},
+		{"lpoptions", &c.Lpoptions, "path to lpoptions"},
+		{"lpstat", &c.Lpstat, "path to lpstat"},
+		{"smartctl", &c.Smartctl, "path to smartctl, for disk health (empty to skip)"},
+		{"xrandr", &c.Xrandr, "path to xrandr"},
+		{"udisksctl", &c.Udisksctl, "path to udisksctl, for unmounting removable media"},
+		{"systemctl", &c.Systemctl, "path to systemctl, for rebooting and shutting down"},
+		{"restart-script", &c.RestartScript, "script restarting the session at log-off"},
+		{"image-version", &c.ImageVersion, "file holding the version of the client image, if any"},
+		{"firefox-policies", &c.FirefoxPolicies, "Firefox policies.json to write (empty to skip)"},
+		{"chromium-policies", &c.ChromiumPolicies, "Chromium managed policy file to write (empty to skip)"},
+		{"policy-staging", &c.PolicyStaging, "directory where policy files are written before they are installed with sudo"},
+		{"cleanup", &c.Cleanup, "cleanup steps at log-off: " + strings.Join(cleanupStepNames, ",")},
+		{"cleanup-wipe", &c.CleanupWipe, "directories in the home directory to empty at log-off"},
+		{"cleanup-restore", &c.CleanupRestore, "directories to restore from a template at log-off, as dir=template"},
+		{"remote-commands", &c.RemoteCommands, "commands Mycel staff may send: " + strings.Join(commandTypes, ",")},
+		{"warnings", &c.Warnings, "warnings before log-off, as minutes=style, with style colour, notification or modal"},
+		{"default-minutes", &c.DefaultMinutes, "minutes per day given to users by the server"},
+		{"exceptions", &c.ExceptionsFile, "opening hours exceptions file, for servers without the exceptions API"},
+		{"exceptions-cache", &c.ExceptionsCache, "where to cache opening hours exceptions"},
+		{"session", &c.SessionFile, "where to save the active session"},
+		{"printers-state", &c.PrintersState, "where to remember the printers set up"},
+		{"printing", &c.Printing, "how to set up printers: lpadmin or ipp"},
+		{"cups", &c.CUPS, "CUPS server (socket path or host:port), for print jobs and ipp printing"},
+		{"auth", &c.Auth, "authentication backend: mycel or sip2"},
+		{"sip2-addr", &c.SIP2Addr, "SIP2 server (host:port)"},
+		{"sip2-user", &c.SIP2User, "SIP2 login user, if required by the server"},
+		{"sip2-password", &c.SIP2Password, "SIP2 login password"},
+		{"sip2-location", &c.SIP2Location, "SIP2 location code"},
+		{"sip2-institution", &c.SIP2Institution, "SIP2 institution id"},
+		{"sip2-checksums", &c.SIP2Checksums, "use SIP2 sequence numbers and checksums"},
+	}
+}
+
+func defaultConfig() *config {
+	return &config{
+		API:              "http://mycel:9000",
+		WS:               "ws://mycel:9001",
+		Sudo:             "/usr/bin/sudo",
+		Lpadmin:          "/usr/sbin/lpadmin",
+		Lpoptions:        "/usr/bin/lpoptions",
+		Lpstat:           "/usr/bin/lpstat",
+		Smartctl:         "/usr/sbin/smartctl",
+		Xrandr:           "/usr/bin/xrandr",
+		Udisksctl:        "/usr/bin/udisksctl",
+		Systemctl:        "/bin/systemctl",
+		RestartScript:    "/srv/pubterm/restart-session.sh",
+		FirefoxPolicies:  "/etc/firefox/policies/policies.json",
+		ChromiumPolicies: "/etc/chromium/policies/managed/mycel.json",
+		PolicyStaging:    cachePath("policies"),
+		Cleanup:          strings.Join(cleanupStepNames, ","),
+		CleanupWipe:      "$HOME/Downloads",
+		CleanupRestore:   "$HOME/.mozilla=/etc/skel/.mozilla,$HOME/.config/chromium=/etc/skel/.config/chromium",
+		RemoteCommands:   strings.Join(defaultCommands, ","),
+		Warnings:         "15=colour,5=modal,1=notification",
+		DefaultMinutes:   60,
+		ExceptionsCache:  cachePath("exceptions.json"),
+		SessionFile:      cachePath("session.json"),
+		PrintersState:    cachePath("printers.json"),
+		Printing:         "lpadmin",
+		CUPS:             ipp.DefaultAddr,
+		Auth:             "mycel",
+	}
+}
+
+// loadConfig reads the config file, environment and command line flags in
+// args, and validates the result.
+func loadConfig(args []string) (*config, error) {
+	// Flags are parsed into a separate config, and only those actually
+	// given are copied over at the end, so that they take precedence.
+	fromFlags := defaultConfig()
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "config file (default "+defaultConfigFile+")")
+	for _, s := range fromFlags.settings() {
+		switch p := s.value.(type) {
+		case *string:
+			fs.StringVar(p, s.name, *p, s.usage)
+		case *int:
+			fs.IntVar(p, s.name, *p, s.usage)
+		case *bool:
+			fs.BoolVar(p, s.name, *p, s.usage)
+		}
+	}
+	fs.Parse(args[1:])
+
+	cfg := defaultConfig()
+	file := *configFile
+	if file == "" {
+		file = os.Getenv("MYCEL_CONFIG")
+	}
+	if err := cfg.readFile(file); err != nil {
+		return nil, err
+	}
+
+	for _, s := range cfg.settings() {
+		if v, ok := os.LookupEnv(s.env()); ok {
+			if err := s.set(v); err != nil {
+				return nil, fmt.Errorf("%s: %v", s.env(), err)
+			}
+		}
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	flagSettings := fromFlags.settings()
+	for i, s := range cfg.settings() {
+		if given[s.name] {
+			s.set(flagSettings[i].String())
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+// readFile reads settings from a JSON config file. If file is empty, the
+// default config file is read, if it exists.
+func (c *config) readFile(file string) error {
+	optional := file == ""
+	if optional {
+		file = defaultConfigFile
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	for _, s := range c.settings() {
+		if v, ok := raw[s.key()]; ok {
+			if err := json.Unmarshal(v, s.value); err != nil {
+				return fmt.Errorf("%s: %s: %v", file, s.key(), err)
+			}
+			delete(raw, s.key())
+		}
+	}
+	for key := range raw {
+		log.Printf("%s: unknown setting %q", file, key)
+	}
+	return nil
+}
+
+// validate checks that the settings make sense.
+func (c *config) validate() error {
+	if err := validURL(c.API, "http", "https"); err != nil {
+		return fmt.Errorf("api: %v", err)
+	}
+	if err := validURL(c.WS, "ws", "wss"); err != nil {
+		return fmt.Errorf("ws: %v", err)
+	}
+	if c.MAC != "" {
+		if _, err := net.ParseMAC(c.MAC); err != nil {
+			return fmt.Errorf("mac: %v", err)
+		}
+	}
+	paths := map[string]string{
+		"sudo":           c.Sudo,
+		"lpadmin":        c.Lpadmin,
+		"lpoptions":      c.Lpoptions,
+		"lpstat":         c.Lpstat,
+		"xrandr":         c.Xrandr,
+		"udisksctl":      c.Udisksctl,
+		"systemctl":      c.Systemctl,
+		"restart-script": c.RestartScript,
+	}
+	if c.Smartctl != "" {
+		paths["smartctl"] = c.Smartctl
+	}
+	for name, path := range paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("%s: %q is not an absolute path", name, path)
+		}
+	}
+	if c.DefaultMinutes <= 0 {
+		return fmt.Errorf("default-minutes: must be positive, not %d", c.DefaultMinutes)
+	}
+	if c.Printing != "lpadmin" && c.Printing != "ipp" {
+		return fmt.Errorf("printing: unknown method %q", c.Printing)
+	}
+	if !filepath.IsAbs(c.CUPS) {
+		if _, _, err := net.SplitHostPort(c.CUPS); err != nil {
+			return fmt.Errorf("cups: %q is neither a socket path nor host:port", c.CUPS)
+		}
+	}
+	for _, name := range splitList(c.Cleanup) {
+		if !contains(cleanupStepNames, name) {
+			return fmt.Errorf("cleanup: unknown step %q", name)
+		}
+	}
+	for _, name := range splitList(c.RemoteCommands) {
+		if !contains(commandTypes, name) {
+			return fmt.Errorf("remote-commands: unknown command %q", name)
+		}
+	}
+	if _, err := c.warnings(); err != nil {
+		return fmt.Errorf("warnings: %v", err)
+	}
+	for _, dir := range splitList(c.CleanupWipe) {
+		if !filepath.IsAbs(os.ExpandEnv(dir)) {
+			return fmt.Errorf("cleanup-wipe: %q is not an absolute path", dir)
+		}
+	}
+	for _, pair := range splitList(c.CleanupRestore) {
+		dirs := strings.SplitN(pair, "=", 2)
+		if len(dirs) != 2 || !filepath.IsAbs(os.ExpandEnv(dirs[0])) || !filepath.IsAbs(dirs[1]) {
+			return fmt.Errorf("cleanup-restore: %q is not dir=template with absolute paths", pair)
+		}
+	}
+	switch c.Auth {
+	case "mycel":
+	case "sip2":
+		if _, _, err := net.SplitHostPort(c.SIP2Addr); err != nil {
+			return fmt.Errorf("sip2-addr: %v", err)
+		}
+	default:
+		return fmt.Errorf("auth: unknown backend %q", c.Auth)
+	}
+	return nil
+}
+
+// authenticator returns the configured authentication backend.
+func (c *config) authenticator() auth.Authenticator {
+	if c.Auth == "sip2" {
+		return &auth.SIP2{
+			Addr:           c.SIP2Addr,
+			LoginUser:      c.SIP2User,
+			LoginPassword:  c.SIP2Password,
+			Location:       c.SIP2Location,
+			Institution:    c.SIP2Institution,
+			Minutes:        c.DefaultMinutes,
+			ErrorDetection: c.SIP2Checksums,
+		}
+	}
+	return &auth.Mycel{HostAPI: c.API}
+}
+
+// warnings parses the warnings setting.
+func (c *config) warnings() ([]window.Warning, error) {
+	var warnings []window.Warning
+	for _, item := range splitList(c.Warnings) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not minutes=style", item)
+		}
+		minutes, err := strconv.Atoi(parts[0])
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("%q: minutes must be a positive number", item)
+		}
+		switch parts[1] {
+		case window.WarnColour, window.WarnNotification, window.WarnModal:
+		default:
+			return nil, fmt.Errorf("%q: unknown style %q", item, parts[1])
+		}
+		warnings = append(warnings, window.Warning{Minutes: minutes, Style: parts[1]})
+	}
+	return warnings, nil
+}
+
+// printerAdmin returns the configured way of setting up printers.
+func (c *config) printerAdmin() printing.Admin {
+	if c.Printing == "ipp" {
+		return &printing.IPP{Client: &ipp.Client{Addr: c.CUPS}}
+	}
+	return &printing.Commands{Sudo: c.Sudo, Lpadmin: c.Lpadmin, Lpoptions: c.Lpoptions, Lpstat: c.Lpstat}
+}
+
+// splitList splits a comma separated setting, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validURL(s string, schemes ...string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme && u.Host != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a %s URL", s, strings.Join(schemes, "/"))
+}
+
+// logSettings writes the settings to the log.
+func (c *config) logSettings() {
+	for _, s := range c.settings() {
+		if s.name == "sip2-password" && s.String() != "" {
+			log.Printf("config: %s = (hidden)", s.name)
+			continue
+		}
+		log.Printf("config: %s = %q", s.name, s.String())
+	}
+}
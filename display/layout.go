@@ -0,0 +1,170 @@
+package display
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Layouts of several monitors.
+const (
+	Extend = "extend" // side by side, left to right from the primary
+	Mirror = "mirror" // all showing the same
+)
+
+// Auto asks for the display's preferred mode.
+const Auto = "auto"
+
+// Settings is the monitor setup from Mycel.
+type Settings struct {
+	Layout  string            `json:"layout"`  // Extend (default) or Mirror
+	Primary string            `json:"primary"` // output name; default the current primary
+	Modes   map[string]string `json:"modes"`   // mode by output name
+}
+
+// Result is the outcome of Apply, as reported to Mycel.
+type Result struct {
+	Layout  string         `json:"layout"`
+	Outputs []OutputResult `json:"outputs"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// OutputResult is the outcome for a single connected output.
+type OutputResult struct {
+	Name      string `json:"name"`
+	Primary   bool   `json:"primary"`
+	Requested string `json:"requested"`
+	Mode      string `json:"mode"`
+	// Fallback is set when the requested mode isn't supported, and the
+	// preferred mode is used instead.
+	Fallback bool `json:"fallback"`
+}
+
+// plan works out the xrandr arguments for setting up outputs with s. Modes
+// not given in s are set to defaultMode.
+func plan(outputs []Output, s Settings, defaultMode string) ([]string, Result, error) {
+	result := Result{Layout: s.Layout}
+	if result.Layout != Mirror {
+		result.Layout = Extend
+	}
+
+	var connected []Output
+	for _, o := range outputs {
+		if o.Connected && len(o.Modes) > 0 {
+			connected = append(connected, o)
+		}
+	}
+	if len(connected) == 0 {
+		return nil, result, errors.New("no connected displays")
+	}
+
+	// The primary output goes first; it is the one the others are placed
+	// relative to
+	primary := 0
+	for i, o := range connected {
+		if o.Name == s.Primary || (s.Primary == "" && o.Primary) {
+			primary = i
+			break
+		}
+	}
+	connected[0], connected[primary] = connected[primary], connected[0]
+
+	// When mirroring, all outputs must use the same mode if they can
+	common := ""
+	if result.Layout == Mirror {
+		common = commonMode(connected, requested(connected[0], s, defaultMode))
+	}
+
+	var args []string
+	for i, o := range connected {
+		r := OutputResult{Name: o.Name, Primary: i == 0, Requested: requested(o, s, defaultMode)}
+		switch {
+		case common != "":
+			r.Mode = common
+		case r.Requested != Auto && o.HasMode(r.Requested):
+			r.Mode = r.Requested
+		default:
+			r.Mode = o.PreferredMode()
+		}
+		r.Fallback = r.Requested != Auto && r.Mode != r.Requested
+		result.Outputs = append(result.Outputs, r)
+
+		args = append(args, "--output", o.Name, "--mode", r.Mode)
+		switch {
+		case i == 0:
+			args = append(args, "--primary", "--pos", "0x0")
+		case result.Layout == Mirror:
+			args = append(args, "--same-as", connected[0].Name)
+		default:
+			args = append(args, "--right-of", connected[i-1].Name)
+		}
+	}
+
+	// Turn off outputs still showing part of the screen after their
+	// display was disconnected
+	for _, o := range outputs {
+		if !o.Connected && o.Active {
+			args = append(args, "--output", o.Name, "--off")
+		}
+	}
+	return args, result, nil
+}
+
+// requested returns the mode requested for o.
+func requested(o Output, s Settings, defaultMode string) string {
+	if mode, ok := s.Modes[o.Name]; ok && mode != "" {
+		return mode
+	}
+	if defaultMode == "" {
+		return Auto
+	}
+	return defaultMode
+}
+
+// commonMode returns the mode to use on all outputs when mirroring: want,
+// if all outputs support it, or else the first mode of the primary output
+// which all support. It returns "" if there is no mode in common.
+func commonMode(outputs []Output, want string) string {
+	supported := func(mode string) bool {
+		for _, o := range outputs {
+			if !o.HasMode(mode) {
+				return false
+			}
+		}
+		return true
+	}
+	if want != Auto && supported(want) {
+		return want
+	}
+	if preferred := outputs[0].PreferredMode(); supported(preferred) {
+		return preferred
+	}
+	for _, m := range outputs[0].Modes {
+		if supported(m.Name) {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// Apply sets up the connected outputs with s, using xrandr. Outputs not in
+// s.Modes get defaultMode, or their preferred mode if it is "" or Auto.
+// Unsupported modes are replaced by the preferred mode.
+func Apply(xrandr string, s Settings, defaultMode string) Result {
+	outputs, err := Query(xrandr)
+	if err != nil {
+		return Result{Error: fmt.Sprintf("%s --query: %v", filepath.Base(xrandr), err)}
+	}
+	args, result, err := plan(outputs, s, defaultMode)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	output, err := exec.Command(xrandr, args...).CombinedOutput()
+	if err != nil {
+		result.Error = fmt.Sprintf("%s: %v: %s", filepath.Base(xrandr), err, strings.TrimSpace(string(output)))
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+package display
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		settings    Settings
+		defaultMode string
+		args        []string
+		result      Result
+		err         string
+	}{
+		{
+			name:   "no connected output",
+			file:   "none.txt",
+			result: Result{Layout: Extend},
+			err:    "no connected displays",
+		},
+		{
+			name: "disconnected output with leftover modes",
+			file: "leftover.txt",
+			args: []string{
+				"--output", "HDMI-1", "--mode", "1920x1080", "--primary", "--pos", "0x0",
+				"--output", "DP-1", "--off",
+			},
+			result: Result{Layout: Extend, Outputs: []OutputResult{
+				{Name: "HDMI-1", Primary: true, Requested: Auto, Mode: "1920x1080"},
+			}},
+		},
+		{
+			name:     "extend",
+			file:     "dual.txt",
+			settings: Settings{Layout: Extend, Modes: map[string]string{"eDP-1": "1280x720"}},
+			args: []string{
+				"--output", "eDP-1", "--mode", "1280x720", "--primary", "--pos", "0x0",
+				"--output", "HDMI-1", "--mode", "2560x1440", "--right-of", "eDP-1",
+			},
+			result: Result{Layout: Extend, Outputs: []OutputResult{
+				{Name: "eDP-1", Primary: true, Requested: "1280x720", Mode: "1280x720"},
+				{Name: "HDMI-1", Requested: Auto, Mode: "2560x1440"},
+			}},
+		},
+		{
+			name:     "extend with another primary",
+			file:     "dual.txt",
+			settings: Settings{Primary: "HDMI-1"},
+			args: []string{
+				"--output", "HDMI-1", "--mode", "2560x1440", "--primary", "--pos", "0x0",
+				"--output", "eDP-1", "--mode", "1920x1080", "--right-of", "HDMI-1",
+			},
+			result: Result{Layout: Extend, Outputs: []OutputResult{
+				{Name: "HDMI-1", Primary: true, Requested: Auto, Mode: "2560x1440"},
+				{Name: "eDP-1", Requested: Auto, Mode: "1920x1080"},
+			}},
+		},
+		{
+			name:     "mirror",
+			file:     "dual.txt",
+			settings: Settings{Layout: Mirror},
+			args: []string{
+				"--output", "eDP-1", "--mode", "1920x1080", "--primary", "--pos", "0x0",
+				"--output", "HDMI-1", "--mode", "1920x1080", "--same-as", "eDP-1",
+			},
+			result: Result{Layout: Mirror, Outputs: []OutputResult{
+				{Name: "eDP-1", Primary: true, Requested: Auto, Mode: "1920x1080"},
+				{Name: "HDMI-1", Requested: Auto, Mode: "1920x1080"},
+			}},
+		},
+		{
+			name:        "mirror in a mode not all support",
+			file:        "dual.txt",
+			settings:    Settings{Layout: Mirror},
+			defaultMode: "2560x1440",
+			args: []string{
+				"--output", "eDP-1", "--mode", "1920x1080", "--primary", "--pos", "0x0",
+				"--output", "HDMI-1", "--mode", "1920x1080", "--same-as", "eDP-1",
+			},
+			result: Result{Layout: Mirror, Outputs: []OutputResult{
+				{Name: "eDP-1", Primary: true, Requested: "2560x1440", Mode: "1920x1080", Fallback: true},
+				{Name: "HDMI-1", Requested: "2560x1440", Mode: "1920x1080", Fallback: true},
+			}},
+		},
+		{
+			name:        "unsupported mode falls back to the preferred",
+			file:        "dual.txt",
+			settings:    Settings{Modes: map[string]string{"HDMI-1": "3840x2160"}},
+			defaultMode: "1024x768",
+			args: []string{
+				"--output", "eDP-1", "--mode", "1024x768", "--primary", "--pos", "0x0",
+				"--output", "HDMI-1", "--mode", "2560x1440", "--right-of", "eDP-1",
+			},
+			result: Result{Layout: Extend, Outputs: []OutputResult{
+				{Name: "eDP-1", Primary: true, Requested: "1024x768", Mode: "1024x768"},
+				{Name: "HDMI-1", Requested: "3840x2160", Mode: "2560x1440", Fallback: true},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		args, result, err := plan(parseFile(t, tt.file), tt.settings, tt.defaultMode)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: args %q, want %q", tt.name, args, tt.args)
+		}
+		if !reflect.DeepEqual(result, tt.result) {
+			t.Errorf("%s: result %+v, want %+v", tt.name, result, tt.result)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package display sets up the client's monitors with xrandr, following the
+// resolution and layout set in Mycel.
+package display
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Mode is a video mode supported by an output, like "1920x1080".
+type Mode struct {
+	Name      string
+	Current   bool // the mode in use
+	Preferred bool // the display's native mode
+}
+
+// Output is a video output, as listed by xrandr --query.
+type Output struct {
+	Name      string
+	Connected bool
+	Primary   bool
+	Active    bool // showing part of the screen
+	Modes     []Mode
+}
+
+// HasMode reports whether the output supports the named mode.
+func (o Output) HasMode(name string) bool {
+	for _, m := range o.Modes {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredMode returns the output's native mode, or failing that, the
+// first, and usually largest, mode listed.
+func (o Output) PreferredMode() string {
+	for _, m := range o.Modes {
+		if m.Preferred {
+			return m.Name
+		}
+	}
+	if len(o.Modes) > 0 {
+		return o.Modes[0].Name
+	}
+	return ""
+}
+
+// Query runs xrandr --query and parses the outputs.
+func Query(xrandr string) ([]Output, error) {
+	out, err := exec.Command(xrandr, "--query").Output()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(strings.NewReader(string(out)))
+}
+
+// Parse parses the output of xrandr --query, e.g.
+//
+//	Screen 0: minimum 320 x 200, current 1920 x 1080, maximum 8192 x 8192
+//	HDMI-1 connected primary 1920x1080+0+0 (normal left inverted right x axis y axis) 527mm x 296mm
+//	   1920x1080     60.00*+  50.00    59.94
+//	   1280x720      60.00    50.00
+//	DP-1 disconnected (normal left inverted right x axis y axis)
+func Parse(r io.Reader) ([]Output, error) {
+	var outputs []Output
+	var o *Output
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, "Screen ") {
+			continue
+		}
+
+		// Modes are indented, and belong to the output above
+		if line[0] == ' ' || line[0] == '\t' {
+			if o == nil || strings.HasSuffix(fields[0], ":") {
+				// The h: and v: lines detail the mode above
+				continue
+			}
+			m := Mode{Name: fields[0]}
+			if len(fields) > 1 && strings.HasPrefix(fields[1], "(") {
+				// Modes not among the output's own, like those left on a
+				// disconnected output, are listed in detail, e.g.
+				// 1920x1080 (0x4a) 148.500MHz +HSync +VSync *current
+				for _, f := range fields[2:] {
+					m.Current = m.Current || f == "*current"
+					m.Preferred = m.Preferred || f == "+preferred"
+				}
+			} else {
+				for _, rate := range fields[1:] {
+					m.Current = m.Current || strings.Contains(rate, "*")
+					m.Preferred = m.Preferred || strings.Contains(rate, "+")
+				}
+			}
+			o.Modes = append(o.Modes, m)
+			continue
+		}
+
+		if len(fields) < 2 {
+			o = nil
+			continue
+		}
+		outputs = append(outputs, Output{
+			Name:      fields[0],
+			Connected: fields[1] == "connected",
+		})
+		o = &outputs[len(outputs)-1]
+		for _, f := range fields[2:] {
+			if f == "primary" {
+				o.Primary = true
+			}
+			// The geometry, e.g. 1920x1080+0+0, is only given when active
+			if strings.Contains(f, "x") && strings.Count(f, "+") == 2 {
+				o.Active = true
+			}
+			if strings.HasPrefix(f, "(") {
+				break
+			}
+		}
+	}
+	return outputs, s.Err()
+}
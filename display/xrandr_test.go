@@ -0,0 +1,92 @@
+package display
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseFile parses captured xrandr --query output in testdata.
+func parseFile(t *testing.T, name string) []Output {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	outputs, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outputs
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file    string
+		outputs []Output
+	}{
+		{
+			file: "none.txt",
+			outputs: []Output{
+				{Name: "eDP-1"},
+				{Name: "HDMI-1"},
+				{Name: "DP-1"},
+			},
+		},
+		{
+			file: "leftover.txt",
+			outputs: []Output{
+				{Name: "HDMI-1", Connected: true, Primary: true, Active: true, Modes: []Mode{
+					{Name: "1920x1080", Current: true, Preferred: true},
+					{Name: "1680x1050"},
+					{Name: "1280x720"},
+				}},
+				{Name: "DP-1", Active: true, Modes: []Mode{
+					{Name: "1920x1080", Current: true},
+				}},
+				{Name: "DP-2"},
+			},
+		},
+		{
+			file: "dual.txt",
+			outputs: []Output{
+				{Name: "eDP-1", Connected: true, Primary: true, Active: true, Modes: []Mode{
+					{Name: "1920x1080", Current: true, Preferred: true},
+					{Name: "1680x1050"},
+					{Name: "1280x1024"},
+					{Name: "1280x720"},
+					{Name: "1024x768"},
+				}},
+				{Name: "HDMI-1", Connected: true, Modes: []Mode{
+					{Name: "2560x1440", Preferred: true},
+					{Name: "1920x1200"},
+					{Name: "1920x1080"},
+					{Name: "1280x1024"},
+					{Name: "1024x768"},
+				}},
+				{Name: "DP-1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if outputs := parseFile(t, tt.file); !reflect.DeepEqual(outputs, tt.outputs) {
+			t.Errorf("%s: parsed\n%+v\nwant\n%+v", tt.file, outputs, tt.outputs)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	// Modes before any output, and outputs without a state, are skipped
+	// rather than crashing
+	input := "   1920x1080 60.00*\nHDMI-1\n   1280x720 60.00\n\t\nDP-1 connected\n   800x600\n"
+	outputs, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Output{{Name: "DP-1", Connected: true, Modes: []Mode{{Name: "800x600"}}}}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("parsed %+v, want %+v", outputs, want)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/digibib/mycel-client/atomicfile"
+)
+
+// exception is a date where the library is closed, or has special opening
+// hours, like public holidays or reduced summer hours.
+type exception struct {
+	Date        string  `json:"date"` // 2006-01-02
+	Closed      bool    `json:"closed"`
+	Opens       *string `json:"opens"`
+	Closes      *string `json:"closes"`
+	Description string  `json:"description"`
+}
+
+// exceptionsResponse matches JSON response from Mycel api/opening_hours/exceptions,
+// and is also the format of the cache and fallback files.
+type exceptionsResponse struct {
+	Exceptions []exception `json:"exceptions"`
+}
+
+// interval returns the opening hours on the exception date, or nil if the
+// library is closed all day.
+func (e exception) interval() (*interval, error) {
+	if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+		return nil, err
+	}
+	if e.Closed {
+		return nil, nil
+	}
+	if e.Opens == nil || e.Closes == nil {
+		return nil, errors.New("neither closed nor opening and closing time given")
+	}
+	opens, err := parseClock(*e.Opens)
+	if err != nil {
+		return nil, fmt.Errorf("opening time: %v", err)
+	}
+	closes, err := parseClock(*e.Closes)
+	if err != nil {
+		return nil, fmt.Errorf("closing time: %v", err)
+	}
+	if closes <= opens {
+		return nil, errors.New("closes before it opens")
+	}
+	return &interval{opens: opens, closes: closes}, nil
+}
+
+// errNoExceptionsAPI is returned by fetchExceptions when the server doesn't
+// have the exceptions API.
+var errNoExceptionsAPI = errors.New("server has no opening hours exceptions API")
+
+// fetchExceptions gets the opening hours exceptions for the client from the
+// Mycel API.
+func fetchExceptions(hostAPI, MAC string) ([]exception, error) {
+	url := fmt.Sprintf("%s/api/opening_hours/exceptions/?mac=%s", hostAPI, MAC)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNoExceptionsAPI
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	r := new(exceptionsResponse)
+	err = json.NewDecoder(resp.Body).Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return r.Exceptions, nil
+}
+
+// readExceptions reads opening hours exceptions from a JSON file.
+func readExceptions(file string) ([]exception, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	r := new(exceptionsResponse)
+	err = json.Unmarshal(b, r)
+	if err != nil {
+		return nil, err
+	}
+	return r.Exceptions, nil
+}
+
+// writeExceptions atomically writes opening hours exceptions to a JSON file.
+func writeExceptions(file string, exceptions []exception) error {
+	b, err := json.Marshal(exceptionsResponse{Exceptions: exceptions})
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(file, b, 0600)
+}
+
+// loadExceptions returns the opening hours exceptions for the client.
+// They are fetched from the Mycel API and cached in cacheFile. If the server
+// is unreachable, the cached copy is used. If the server doesn't expose
+// exceptions at all, they are read from fallbackFile, if given.
+func loadExceptions(hostAPI, MAC, cacheFile, fallbackFile string) []exception {
+	exceptions, err := fetchExceptions(hostAPI, MAC)
+	if err == nil {
+		if err := writeExceptions(cacheFile, exceptions); err != nil {
+			log.Println("failed to cache opening hours exceptions: ", err)
+		}
+		return exceptions
+	}
+
+	file := cacheFile
+	if errors.Is(err, errNoExceptionsAPI) {
+		if fallbackFile == "" {
+			return nil
+		}
+		file = fallbackFile
+	} else {
+		log.Println("failed to fetch opening hours exceptions, using cached copy: ", err)
+	}
+	exceptions, err = readExceptions(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to read opening hours exceptions from %s: %v", file, err)
+	}
+	return exceptions
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/digibib/mycel-client/i18n"
+	"github.com/digibib/mycel-client/window"
+)
+
+// timeExtension is the time_extension client option, which lets patrons
+// ask for more time from the status window.
+type timeExtension struct {
+	Minutes     int  `json:"minutes"`      // minutes asked for
+	MaxRequests int  `json:"max_requests"` // per session, or 0 for no limit
+	AutoApprove bool `json:"auto_approve"` // approve without asking staff when possible
+	// No requests are approved automatically this many minutes before
+	// closing
+	ClosingMargin int `json:"closing_margin"`
+}
+
+// timeRequestTimeout is how long to wait for staff to answer a request
+// before the patron may ask again.
+const timeRequestTimeout = 10 * time.Minute
+
+// timeRequest asks Mycel staff for more minutes for the user, or tells
+// them the request was approved automatically.
+type timeRequest struct {
+	Action       string `json:"action"` // "time-request"
+	Client       int    `json:"client"`
+	User         string `json:"user"`
+	ID           string `json:"id"`
+	Minutes      int    `json:"minutes"`
+	AutoApproved bool   `json:"auto_approved"`
+}
+
+// timeResponse is the staff's answer to a request, sent over the websocket
+// as {"status": "time-response", "time_response": {...}}.
+type timeResponse struct {
+	ID       string `json:"id"`
+	Approved bool   `json:"approved"`
+	Minutes  int    `json:"minutes"`
+}
+
+// timeRequests keeps track of a session's requests for more time. It is
+// only used from the session goroutine.
+type timeRequests struct {
+	rules   timeExtension
+	count   int       // requests made in the session
+	pending string    // id of the unanswered request, if any
+	sent    time.Time // when the pending request was sent
+	waiting *int      // patrons waiting for a computer, as last reported by Mycel
+}
+
+// available reports whether the user may ask for more time.
+func (r *timeRequests) available() bool {
+	return r.rules.MaxRequests <= 0 || r.count < r.rules.MaxRequests
+}
+
+// autoApprove reports whether a request at now can be approved without
+// asking staff: nobody is waiting for a computer, and the library doesn't
+// close soon after the extra time.
+func (r *timeRequests) autoApprove(now, closes time.Time) bool {
+	if !r.rules.AutoApprove || r.waiting == nil || *r.waiting > 0 {
+		return false
+	}
+	margin := time.Duration(r.rules.Minutes+r.rules.ClosingMargin) * time.Minute
+	return closes.IsZero() || !now.Add(margin).After(closes)
+}
+
+// request handles a click on "Ask for more time". The GDK lock must be
+// held.
+func (r *timeRequests) request(ws *link, user string, s *commandSession) {
+	if r.pending != "" || !r.available() {
+		return
+	}
+	now := time.Now()
+	r.count++
+	req := timeRequest{
+		Action:  "time-request",
+		Client:  ws.client,
+		User:    user,
+		ID:      strconv.FormatInt(now.UnixNano(), 36),
+		Minutes: r.rules.Minutes,
+	}
+	if r.autoApprove(now, s.closes) {
+		req.AutoApproved = true
+		ws.send(req)
+		log.Printf("gave %s %d more minutes", user, req.Minutes)
+		r.answered(timeResponse{ID: req.ID, Approved: true, Minutes: req.Minutes}, s)
+		return
+	}
+	ws.send(req)
+	r.pending, r.sent = req.ID, now
+	s.status.SetTimeRequest(true, true)
+}
+
+// answer applies the staff's answer to the pending request. The GDK lock
+// must be held.
+func (r *timeRequests) answer(resp timeResponse, s *commandSession) {
+	if resp.ID == "" || resp.ID != r.pending {
+		return
+	}
+	r.pending = ""
+	r.answered(resp, s)
+}
+
+func (r *timeRequests) answered(resp timeResponse, s *commandSession) {
+	text := i18n.T("Du fikk ikke mer tid")
+	if resp.Approved && resp.Minutes > 0 {
+		s.addMinutes(resp.Minutes)
+		text = i18n.T("Du fikk %d minutter til", resp.Minutes)
+	}
+	window.AddNotice(window.Notice{ID: "time-" + resp.ID, Text: text, Severity: "info", Expires: time.Now().Add(time.Minute)}, nil)
+	s.status.SetTimeRequest(false, r.available())
+}
+
+// expire lets the user ask again if staff haven't answered in time. The
+// GDK lock must be held.
+func (r *timeRequests) expire(now time.Time, s *commandSession) {
+	if r.pending != "" && now.Sub(r.sent) > timeRequestTimeout {
+		log.Printf("time request %s was not answered", r.pending)
+		r.pending = ""
+		s.status.SetTimeRequest(false, r.available())
+	}
+}
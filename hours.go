@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// weekdayKeys holds the JSON key prefixes used by the Mycel API for each
+// weekday, indexed by time.Weekday. Wednesday is misspelled by the server;
+// the correct spelling is accepted as well.
+var weekdayKeys = [7][]string{
+	time.Sunday:    {"sunday"},
+	time.Monday:    {"monday"},
+	time.Tuesday:   {"tuesday"},
+	time.Wednesday: {"wednsday", "wednesday"},
+	time.Thursday:  {"thursday"},
+	time.Friday:    {"friday"},
+	time.Saturday:  {"saturday"},
+}
+
+// interval is a daily opening period, in minutes after midnight.
+type interval struct {
+	opens  int
+	closes int
+}
+
+// openingHours is the weekly opening schedule of a client, parsed from the
+// opening_hours object in the Mycel api/clients response.
+//
+// A nil *openingHours means the client has no opening hours, and is
+// treated as always open.
+type openingHours struct {
+	days [7]*interval // indexed by time.Weekday; nil when closed all day
+
+	// exceptions override the weekly schedule on specific dates, keyed by
+	// "2006-01-02". A nil interval means closed all day.
+	exceptions map[string]*interval
+
+	// minutesBeforeClosing is subtracted from the closing time, so that
+	// patrons are logged off before the library actually closes.
+	minutesBeforeClosing int
+
+	// alwaysOpen is set when there is no weekly schedule, only exceptions.
+	// Days without an exception are then open around the clock, and don't
+	// close at midnight.
+	alwaysOpen bool
+}
+
+// UnmarshalJSON parses the opening_hours object from the Mycel API.
+// A day flagged as closed, or without any opening or closing time, is closed
+// all day. A missing opening time means midnight, and a missing closing time
+// means the end of the day. Days with invalid times are logged and treated
+// as closed.
+func (h *openingHours) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var parsed openingHours
+	for day, keys := range weekdayKeys {
+		iv, err := parseDay(raw, keys)
+		if err != nil {
+			// Don't refuse the whole client over one bad day
+			log.Printf("ignoring %s opening hours: %v", keys[0], err)
+			continue
+		}
+		parsed.days[day] = iv
+	}
+
+	if err := decodeKey(raw, "minutes_before_closing", &parsed.minutesBeforeClosing); err != nil {
+		return err
+	}
+
+	*h = parsed
+	return nil
+}
+
+// parseDay returns the opening interval of a single weekday, or nil if the
+// library is closed all that day.
+func parseDay(raw map[string]json.RawMessage, keys []string) (*interval, error) {
+	var opens, closes *string
+	var closed *bool
+	for _, key := range keys {
+		if err := decodeKey(raw, key+"_opens", &opens); err != nil {
+			return nil, err
+		}
+		if err := decodeKey(raw, key+"_closes", &closes); err != nil {
+			return nil, err
+		}
+		if err := decodeKey(raw, key+"_closed", &closed); err != nil {
+			return nil, err
+		}
+	}
+	if (closed != nil && *closed) || (opens == nil && closes == nil) {
+		return nil, nil
+	}
+
+	iv := &interval{opens: 0, closes: 24 * 60}
+	if opens != nil {
+		m, err := parseClock(*opens)
+		if err != nil {
+			return nil, fmt.Errorf("opening time: %v", err)
+		}
+		iv.opens = m
+	}
+	if closes != nil {
+		m, err := parseClock(*closes)
+		if err != nil {
+			return nil, fmt.Errorf("closing time: %v", err)
+		}
+		iv.closes = m
+	}
+	if iv.closes <= iv.opens {
+		return nil, fmt.Errorf("closes before it opens")
+	}
+	return iv, nil
+}
+
+// decodeKey decodes raw[key] into v, if the key is present and not null.
+func decodeKey(raw map[string]json.RawMessage, key string, v interface{}) error {
+	val, ok := raw[key]
+	if !ok || string(val) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(val, v); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+// parseClock converts a "15:04" (or "15:04:05") clock time to minutes after
+// midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		var err2 error
+		t, err2 = time.Parse("15:04:05", s)
+		if err2 != nil {
+			return 0, err
+		}
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// withExceptions returns a copy of h where the given exceptions take
+// precedence over the weekly schedule. Without any weekly opening hours, the
+// library is open all day except on the exception dates.
+func (h *openingHours) withExceptions(exceptions []exception) *openingHours {
+	if len(exceptions) == 0 {
+		return h
+	}
+	c := openingHours{exceptions: make(map[string]*interval)}
+	if h != nil {
+		c.days = h.days
+		c.minutesBeforeClosing = h.minutesBeforeClosing
+		c.alwaysOpen = h.alwaysOpen
+		for date, iv := range h.exceptions {
+			c.exceptions[date] = iv
+		}
+	} else {
+		c.alwaysOpen = true
+		for day := range c.days {
+			c.days[day] = &interval{opens: 0, closes: 24 * 60}
+		}
+	}
+	for _, e := range exceptions {
+		iv, err := e.interval()
+		if err != nil {
+			log.Printf("ignoring opening hours exception for %s: %v", e.Date, err)
+			continue
+		}
+		c.exceptions[e.Date] = iv
+	}
+	return &c
+}
+
+// period returns the opening and closing time of the day of t, with the
+// closing time adjusted by minutesBeforeClosing. Exceptions for the date
+// take precedence over the weekly schedule. ok is false if the library is
+// closed all that day.
+func (h *openingHours) period(t time.Time) (opens, closes time.Time, ok bool) {
+	iv, found := h.exceptions[t.Format("2006-01-02")]
+	if !found {
+		iv = h.days[t.Weekday()]
+	}
+	if iv == nil {
+		return
+	}
+	y, m, d := t.Date()
+	opens = time.Date(y, m, d, 0, iv.opens, 0, 0, t.Location())
+	closes = time.Date(y, m, d, 0, iv.closes-h.minutesBeforeClosing, 0, 0, t.Location())
+	return opens, closes, closes.After(opens)
+}
+
+// isException reports whether there is an exception for the day of t.
+func (h *openingHours) isException(t time.Time) bool {
+	_, found := h.exceptions[t.Format("2006-01-02")]
+	return found
+}
+
+// isOpen reports whether the library is open at time t.
+func (h *openingHours) isOpen(t time.Time) bool {
+	if h == nil {
+		return true
+	}
+	opens, closes, ok := h.period(t)
+	return ok && !t.Before(opens) && t.Before(closes)
+}
+
+// closingTime returns when the library closes, if it is open at time t.
+// ok is false if the library is closed at t, has no opening hours, or is
+// open around the clock.
+func (h *openingHours) closingTime(t time.Time) (closes time.Time, ok bool) {
+	if h == nil || !h.isOpen(t) {
+		return time.Time{}, false
+	}
+	_, closes, _ = h.period(t)
+	if h.alwaysOpen && !h.isException(t) {
+		// closes is midnight, which is only a closing time if the next day
+		// has an exception which doesn't open right away
+		if !h.isException(closes) {
+			return time.Time{}, false
+		}
+		if opens, _, open := h.period(closes); open && opens.Equal(closes) {
+			return time.Time{}, false
+		}
+	}
+	return closes, true
+}
+
+// nextOpening returns the earliest time at or after t when the library is
+// open. ok is false if the library is not open within the next year.
+func (h *openingHours) nextOpening(t time.Time) (opens time.Time, ok bool) {
+	if h.isOpen(t) {
+		return t, true
+	}
+	for i := 0; i <= 366; i++ {
+		y, m, d := t.Date()
+		day := time.Date(y, m, d+i, 12, 0, 0, 0, t.Location())
+		o, _, open := h.period(day)
+		if open && !o.Before(t) {
+			return o, true
+		}
+	}
+	return time.Time{}, false
+}
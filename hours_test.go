@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// at returns the given time in May 2024, when the 1st is a Wednesday.
+func at(day, hour, min int) time.Time {
+	return time.Date(2024, time.May, day, hour, min, 0, 0, time.UTC)
+}
+
+func parseHours(t *testing.T, s string) *openingHours {
+	t.Helper()
+	var h openingHours
+	if err := json.Unmarshal([]byte(s), &h); err != nil {
+		t.Fatal(err)
+	}
+	return &h
+}
+
+// weekdays is open 9-17 on weekdays, with Wednesday misspelled like the
+// Mycel API does, and closed at weekends.
+const weekdays = `{
+	"monday_opens": "09:00", "monday_closes": "17:00",
+	"tuesday_opens": "09:00", "tuesday_closes": "17:00",
+	"wednsday_opens": "09:00", "wednsday_closes": "17:00",
+	"thursday_opens": "09:00", "thursday_closes": "17:00",
+	"friday_opens": "09:00", "friday_closes": "17:00",
+	"saturday_closed": true,
+	"minutes_before_closing": 10
+}`
+
+func TestOpeningHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		hours   string
+		t       time.Time
+		open    bool
+		closes  time.Time // zero if no closing time
+		opening time.Time // next opening at or after t
+	}{
+		{
+			name:    "open",
+			hours:   weekdays,
+			t:       at(1, 12, 0),
+			open:    true,
+			closes:  at(1, 16, 50),
+			opening: at(1, 12, 0),
+		},
+		{
+			name:    "before opening",
+			hours:   weekdays,
+			t:       at(1, 8, 0),
+			opening: at(1, 9, 0),
+		},
+		{
+			name:    "minutes before closing",
+			hours:   weekdays,
+			t:       at(1, 16, 55),
+			opening: at(2, 9, 0),
+		},
+		{
+			name:    "closed at the weekend",
+			hours:   weekdays,
+			t:       at(4, 12, 0),
+			opening: at(6, 9, 0),
+		},
+		{
+			name:    "wraps around to next week",
+			hours:   `{"monday_opens": "10:00", "monday_closes": "14:00"}`,
+			t:       at(7, 12, 0),
+			opening: at(13, 10, 0),
+		},
+		{
+			name:    "wednesday spelled correctly",
+			hours:   `{"wednesday_opens": "10:00", "wednesday_closes": "14:00"}`,
+			t:       at(1, 11, 0),
+			open:    true,
+			closes:  at(1, 14, 0),
+			opening: at(1, 11, 0),
+		},
+		{
+			name:    "missing opening time means midnight",
+			hours:   `{"wednsday_closes": "14:00"}`,
+			t:       at(1, 0, 30),
+			open:    true,
+			closes:  at(1, 14, 0),
+			opening: at(1, 0, 30),
+		},
+		{
+			name:    "invalid day is closed",
+			hours:   `{"wednsday_opens": "14:00", "wednsday_closes": "10:00", "thursday_opens": "10:00", "thursday_closes": "14:00"}`,
+			t:       at(1, 12, 0),
+			opening: at(2, 10, 0),
+		},
+	}
+	for _, tt := range tests {
+		h := parseHours(t, tt.hours)
+		if open := h.isOpen(tt.t); open != tt.open {
+			t.Errorf("%s: isOpen = %v, want %v", tt.name, open, tt.open)
+		}
+		closes, ok := h.closingTime(tt.t)
+		if ok != !tt.closes.IsZero() || !closes.Equal(tt.closes) {
+			t.Errorf("%s: closingTime = %v, %v, want %v", tt.name, closes, ok, tt.closes)
+		}
+		opening, ok := h.nextOpening(tt.t)
+		if !ok || !opening.Equal(tt.opening) {
+			t.Errorf("%s: nextOpening = %v, %v, want %v", tt.name, opening, ok, tt.opening)
+		}
+	}
+}
+
+func TestNoOpeningHours(t *testing.T) {
+	var h *openingHours
+	if !h.isOpen(at(1, 3, 0)) {
+		t.Error("no opening hours should be always open")
+	}
+	if closes, ok := h.closingTime(at(1, 3, 0)); ok {
+		t.Errorf("no opening hours closes at %v", closes)
+	}
+}
+
+func TestWithExceptions(t *testing.T) {
+	opens, closes := "10:00", "14:00"
+	exceptions := []exception{
+		{Date: "2024-05-01", Closed: true},
+		{Date: "2024-05-02", Opens: &opens, Closes: &closes},
+		{Date: "2024-05-31", Opens: &opens, Closes: &closes},
+		{Date: "bad date", Closed: true},
+	}
+
+	tests := []struct {
+		name    string
+		hours   *openingHours
+		t       time.Time
+		open    bool
+		closes  time.Time
+		opening time.Time
+	}{
+		{
+			name:    "closed on holiday",
+			hours:   parseHours(t, weekdays),
+			t:       at(1, 12, 0),
+			opening: at(2, 10, 0),
+		},
+		{
+			name:    "special hours",
+			hours:   parseHours(t, weekdays),
+			t:       at(2, 12, 0),
+			open:    true,
+			closes:  at(2, 13, 50),
+			opening: at(2, 12, 0),
+		},
+		{
+			name:    "weekly schedule on other days",
+			hours:   parseHours(t, weekdays),
+			t:       at(3, 12, 0),
+			open:    true,
+			closes:  at(3, 16, 50),
+			opening: at(3, 12, 0),
+		},
+		{
+			name:    "no weekly hours, open around the clock",
+			t:       at(6, 23, 30),
+			open:    true,
+			opening: at(6, 23, 30),
+		},
+		{
+			name:    "no weekly hours, closes before holiday",
+			t:       at(30, 23, 30),
+			open:    true,
+			closes:  at(31, 0, 0),
+			opening: at(30, 23, 30),
+		},
+		{
+			name:    "no weekly hours, closed on holiday",
+			t:       at(1, 12, 0),
+			opening: at(2, 10, 0),
+		},
+	}
+	for _, tt := range tests {
+		h := tt.hours.withExceptions(exceptions)
+		if open := h.isOpen(tt.t); open != tt.open {
+			t.Errorf("%s: isOpen = %v, want %v", tt.name, open, tt.open)
+		}
+		closes, ok := h.closingTime(tt.t)
+		if ok != !tt.closes.IsZero() || !closes.Equal(tt.closes) {
+			t.Errorf("%s: closingTime = %v, %v, want %v", tt.name, closes, ok, tt.closes)
+		}
+		opening, ok := h.nextOpening(tt.t)
+		if !ok || !opening.Equal(tt.opening) {
+			t.Errorf("%s: nextOpening = %v, %v, want %v", tt.name, opening, ok, tt.opening)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package i18n translates the patron facing messages of the client.
+//
+// Messages are identified by their Norwegian text, which is also used when
+// there is no translation. The translations are JSON files in locales/,
+// embedded in the binary, mapping Norwegian messages to the translated ones.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Language is a language patrons can choose.
+type Language struct {
+	Code string
+	Name string // in the language itself
+	RTL  bool   // written right-to-left
+}
+
+// Languages lists the available languages, the default first.
+var Languages = []Language{
+	{Code: "nb", Name: "Norsk"},
+	{Code: "en", Name: "English"},
+	{Code: "pl", Name: "Polski"},
+	{Code: "ar", Name: "العربية", RTL: true},
+	{Code: "so", Name: "Soomaali"},
+	{Code: "ur", Name: "اردو", RTL: true},
+}
+
+var (
+	mu       sync.Mutex
+	current  = Languages[0]
+	catalogs = make(map[string]map[string]string)
+)
+
+// catalog returns the translations for a language, loading them on first
+// use. The default language has no catalog.
+func catalog(code string) map[string]string {
+	if c, ok := catalogs[code]; ok {
+		return c
+	}
+	c := make(map[string]string)
+	b, err := locales.ReadFile("locales/" + code + ".json")
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil && code != Languages[0].Code {
+		log.Printf("failed to load %s translations: %v", code, err)
+	}
+	catalogs[code] = c
+	return c
+}
+
+// SetLanguage sets the language of all messages from now on. Unknown
+// language codes are ignored.
+func SetLanguage(code string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, l := range Languages {
+		if l.Code == code {
+			current = l
+			return
+		}
+	}
+}
+
+// Current returns the language in use.
+func Current() Language {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// T translates msg to the current language, and formats it with args as
+// fmt.Sprintf does. Messages without a translation are used as is.
+func T(msg string, args ...interface{}) string {
+	mu.Lock()
+	if s, ok := catalog(current.Code)[msg]; ok && s != "" {
+		msg = s
+	}
+	mu.Unlock()
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sysNet is where the kernel describes network interfaces.
+var sysNet = "/sys/class/net"
+
+// errUnknownClient is returned by identifyAny when none of the MAC addresses
+// are registered in the Mycel DB.
+var errUnknownClient = errors.New("client MAC address not found in mycel DB")
+
+// virtualPrefixes are names of interfaces which never identify a client.
+var virtualPrefixes = []string{"lo", "docker", "veth", "br-", "virbr", "vmnet", "vboxnet", "tun", "tap", "wg", "zt"}
+
+// nic is a network interface that may identify the client.
+type nic struct {
+	name     string
+	mac      string
+	up       bool
+	wireless bool
+}
+
+// candidateMACs returns the MAC addresses that may identify the client, the
+// most likely first. A MAC address or interface pinned in the config is
+// used as is. Otherwise, physical interfaces are preferred when up, and
+// wired over wireless.
+func candidateMACs(cfg *config) ([]string, error) {
+	if cfg.MAC != "" {
+		mac, err := net.ParseMAC(cfg.MAC)
+		if err != nil {
+			return nil, err
+		}
+		return []string{mac.String()}, nil
+	}
+	if cfg.Interface != "" {
+		iface, err := net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cfg.Interface, err)
+		}
+		if len(iface.HardwareAddr) == 0 {
+			return nil, fmt.Errorf("%s has no MAC address", cfg.Interface)
+		}
+		return []string{iface.HardwareAddr.String()}, nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var nics []nic
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 || isVirtual(iface.Name) {
+			continue
+		}
+		nics = append(nics, nic{
+			name:     iface.Name,
+			mac:      iface.HardwareAddr.String(),
+			up:       iface.Flags&net.FlagUp != 0 && operstate(iface.Name) != "down",
+			wireless: isWireless(iface.Name),
+		})
+	}
+	if len(nics) == 0 {
+		return nil, errors.New("no network interfaces found")
+	}
+
+	sort.SliceStable(nics, func(i, j int) bool {
+		a, b := nics[i], nics[j]
+		if a.up != b.up {
+			return a.up
+		}
+		if a.wireless != b.wireless {
+			return !a.wireless
+		}
+		return a.name < b.name
+	})
+	var macs []string
+	for _, n := range nics {
+		macs = append(macs, n.mac)
+	}
+	return macs, nil
+}
+
+// isVirtual reports whether the interface is not backed by a device, like
+// loopback, bridges, docker and VPN interfaces.
+func isVirtual(name string) bool {
+	for _, prefix := range virtualPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	_, err := os.Stat(filepath.Join(sysNet, name, "device"))
+	return os.IsNotExist(err)
+}
+
+func isWireless(name string) bool {
+	_, err := os.Stat(filepath.Join(sysNet, name, "wireless"))
+	return err == nil || strings.HasPrefix(name, "wl")
+}
+
+// operstate returns the operational state of the link, e.g. "up", "down"
+// or "unknown".
+func operstate(name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(sysNet, name, "operstate"))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// identifyAny tries each MAC address in turn, and returns the client for the
+// first one known to the Mycel DB.
+func identifyAny(hostAPI string, macs []string) (client *Client, MAC string, err error) {
+	for _, MAC = range macs {
+		client, err = identify(hostAPI, MAC)
+		if err == nil {
+			return client, MAC, nil
+		}
+		if err.Error() != "404 Not Found" {
+			return nil, "", err
+		}
+	}
+	return nil, "", errUnknownClient
+}
@@ -0,0 +1,52 @@
+// Package idle tells how long the user has been away from the keyboard and
+// mouse, using the X screen saver extension.
+package idle
+
+/*
+#cgo pkg-config: x11 xscrnsaver
+#include <X11/Xlib.h>
+#include <X11/extensions/scrnsaver.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// Monitor queries the idle time of an X display. It must only be used from
+// one goroutine at a time.
+type Monitor struct {
+	display *C.Display
+	info    *C.XScreenSaverInfo
+}
+
+// Open connects to the X display in $DISPLAY.
+func Open() (*Monitor, error) {
+	display := C.XOpenDisplay(nil)
+	if display == nil {
+		return nil, errors.New("can't open X display")
+	}
+	var event, errorBase C.int
+	if C.XScreenSaverQueryExtension(display, &event, &errorBase) == 0 {
+		C.XCloseDisplay(display)
+		return nil, errors.New("X server has no screen saver extension")
+	}
+	return &Monitor{display: display, info: C.XScreenSaverAllocInfo()}, nil
+}
+
+// Idle returns the time since the last keyboard or mouse input.
+func (m *Monitor) Idle() time.Duration {
+	root := C.XDefaultRootWindow(m.display)
+	if C.XScreenSaverQueryInfo(m.display, C.Drawable(root), m.info) == 0 {
+		return 0
+	}
+	return time.Duration(m.info.idle) * time.Millisecond
+}
+
+// Close disconnects from the display.
+func (m *Monitor) Close() {
+	C.XFree(unsafe.Pointer(m.info))
+	C.XCloseDisplay(m.display)
+}
@@ -0,0 +1,127 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Disk is a block device backed by hardware.
+type Disk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	Bytes      int64  `json:"bytes"`
+	Serial     string `json:"serial,omitempty"`
+	Rotational bool   `json:"rotational"`
+	Removable  bool   `json:"removable"`
+	Health     string `json:"health"` // SMART health: passed, failed or unknown
+}
+
+// Link is a network interface backed by hardware. Its state and speed are
+// left out, as they change whenever a cable is plugged in or out.
+type Link struct {
+	Name     string `json:"name"`
+	MAC      string `json:"mac"`
+	Wireless bool   `json:"wireless"`
+}
+
+// disks lists the disks in /sys/block. Loop, RAM and device mapper devices
+// have no "device" link, and are left out.
+func disks(dir string) []Disk {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var disks []Disk
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(path, "device")); err != nil {
+			continue
+		}
+		model := readLine(filepath.Join(path, "device/model"))
+		if model == "" {
+			model = Unknown
+		}
+		disks = append(disks, Disk{
+			Name:  e.Name(),
+			Model: model,
+			// The size is always in 512 byte sectors
+			Bytes:      readInt(filepath.Join(path, "size")) * 512,
+			Serial:     readLine(filepath.Join(path, "device/serial")),
+			Rotational: readLine(filepath.Join(path, "queue/rotational")) == "1",
+			Removable:  readLine(filepath.Join(path, "removable")) == "1",
+			Health:     Unknown,
+		})
+	}
+	return disks
+}
+
+// CheckHealth asks smartctl for the SMART health of the disks, which needs
+// root. smartctl is run with sudo -n, unless sudo is empty. The health of
+// disks which don't support SMART stays Unknown.
+func (inv *Inventory) CheckHealth(sudo, smartctl string) {
+	for i := range inv.Disks {
+		if inv.Disks[i].Removable {
+			continue
+		}
+		args := []string{"-H", "/dev/" + inv.Disks[i].Name}
+		var cmd *exec.Cmd
+		if sudo != "" {
+			cmd = exec.Command(sudo, append([]string{"-n", smartctl}, args...)...)
+		} else {
+			cmd = exec.Command(smartctl, args...)
+		}
+		// smartctl exits with a non-zero status when the disk is failing,
+		// so the output is checked regardless
+		output, _ := cmd.Output()
+		inv.Disks[i].Health = smartHealth(string(output))
+	}
+}
+
+// smartHealth finds the health in the output of smartctl -H. ATA and NVMe
+// disks report "...self-assessment test result: PASSED", and SCSI disks
+// "SMART Health Status: OK".
+func smartHealth(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.LastIndex(line, ":")
+		if i < 0 || !(strings.Contains(line, "self-assessment test result") || strings.Contains(line, "SMART Health Status")) {
+			continue
+		}
+		switch strings.TrimSpace(line[i+1:]) {
+		case "PASSED", "OK":
+			return "passed"
+		default:
+			return "failed"
+		}
+	}
+	return Unknown
+}
+
+// links lists the network interfaces in /sys/class/net. Loopback, bridges,
+// VPN and other virtual interfaces have no "device" link, and are left out.
+func links(dir string) []Link {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var links []Link
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(path, "device")); err != nil {
+			continue
+		}
+		l := Link{
+			Name: e.Name(),
+			MAC:  readLine(filepath.Join(path, "address")),
+		}
+		if l.MAC == "" {
+			l.MAC = Unknown
+		}
+		_, err := os.Stat(filepath.Join(path, "wireless"))
+		l.Wireless = err == nil || strings.HasPrefix(e.Name(), "wl")
+		links = append(links, l)
+	}
+	return links
+}
@@ -0,0 +1,93 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Display is a connected monitor, as described by its EDID.
+type Display struct {
+	Connector    string `json:"connector"` // e.g. "HDMI-A-1"
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+	Serial       string `json:"serial"`
+	Resolution   string `json:"resolution"` // native resolution, e.g. "1920x1080"
+}
+
+// edidHeader starts every EDID block.
+var edidHeader = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// displays lists the connected monitors in /sys/class/drm.
+func displays(dir string) []Display {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var displays []Display
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if readLine(filepath.Join(path, "status")) != "connected" {
+			continue
+		}
+		// The directories are named by card and connector, e.g.
+		// card0-HDMI-A-1
+		d := Display{Connector: e.Name()}
+		if i := strings.Index(e.Name(), "-"); i >= 0 {
+			d.Connector = e.Name()[i+1:]
+		}
+		edid, _ := ioutil.ReadFile(filepath.Join(path, "edid"))
+		parseEDID(edid, &d)
+		displays = append(displays, d)
+	}
+	return displays
+}
+
+// parseEDID fills in d from an EDID block. Values it doesn't contain are
+// Unknown.
+func parseEDID(edid []byte, d *Display) {
+	d.Manufacturer, d.Model, d.Serial, d.Resolution = Unknown, Unknown, Unknown, Unknown
+	if len(edid) < 128 || string(edid[:8]) != string(edidHeader) {
+		return
+	}
+
+	// The manufacturer is three letters, packed in five bits each
+	id := binary.BigEndian.Uint16(edid[8:10])
+	d.Manufacturer = string([]byte{
+		byte(id>>10&0x1f) + 'A' - 1,
+		byte(id>>5&0x1f) + 'A' - 1,
+		byte(id&0x1f) + 'A' - 1,
+	})
+	d.Model = fmt.Sprintf("%04x", binary.LittleEndian.Uint16(edid[10:12]))
+	if serial := binary.LittleEndian.Uint32(edid[12:16]); serial != 0 {
+		d.Serial = fmt.Sprint(serial)
+	}
+
+	// Four 18 byte descriptors follow at offset 54. The first is normally
+	// the preferred, native, timing; the others may hold the monitor name
+	// and serial number as text.
+	for i := 54; i+18 <= 126; i += 18 {
+		desc := edid[i : i+18]
+		if desc[0] != 0 || desc[1] != 0 {
+			if d.Resolution == Unknown {
+				h := int(desc[2]) | int(desc[4]&0xf0)<<4
+				v := int(desc[5]) | int(desc[7]&0xf0)<<4
+				d.Resolution = fmt.Sprintf("%dx%d", h, v)
+			}
+			continue
+		}
+		text := strings.TrimSpace(strings.SplitN(string(desc[5:18]), "\n", 2)[0])
+		switch desc[3] {
+		case 0xfc:
+			if text != "" {
+				d.Model = text
+			}
+		case 0xff:
+			if text != "" {
+				d.Serial = text
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package inventory describes the client hardware, as reported to Mycel.
+// Nearly everything is read from sysfs and procfs, so that neither root nor
+// dmidecode is needed. Only the DMI serial number and UUID, and the disk
+// health, need root, and are read with sudo.
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Unknown is reported for text values which can't be found. Unknown
+// numbers are reported as 0.
+const Unknown = "unknown"
+
+// placeholders are values vendors leave in the DMI tables instead of real
+// ones.
+var placeholders = []string{
+	"", "to be filled by o.e.m.", "default string", "not specified",
+	"not applicable", "none", "system product name", "system manufacturer",
+	"system version", "system serial number", "0123456789", "x.x",
+	"03000200-0400-0500-0006-000700080009",
+}
+
+// Inventory describes the client hardware. The JSON keys of the first
+// fields match those once posted from dmidecode.
+type Inventory struct {
+	Manufacturer   string `json:"manufacturer"`
+	ProductName    string `json:"product_name"`
+	ProductVersion string `json:"product_version"`
+	SerialNumber   string `json:"serial_number"`
+	UUID           string `json:"uuid"`
+	RAM            string `json:"ram"` // installed memory, rounded up, e.g. "8 GB"
+	CPUFamily      string `json:"cpu_family"`
+
+	BIOSVendor  string `json:"bios_vendor"`
+	BIOSVersion string `json:"bios_version"`
+	BoardName   string `json:"board_name"`
+	MemoryKB    int    `json:"memory_kb"` // usable memory, from /proc/meminfo
+	CPUModel    string `json:"cpu_model"`
+	CPUs        int    `json:"cpus"` // logical processors
+	Disks       []Disk `json:"disks"`
+	Links       []Link `json:"links"`
+
+	Displays  []Display   `json:"displays"`
+	USB       []USBDevice `json:"usb"`
+	Batteries []Battery   `json:"batteries"`
+
+	OS           string `json:"os"`     // PRETTY_NAME from os-release
+	Kernel       string `json:"kernel"` // kernel release
+	ImageVersion string `json:"image_version"`
+}
+
+// Read collects the inventory from the filesystem at root, which is "/"
+// except when reading a copy of a sysfs and procfs tree.
+func Read(root string) Inventory {
+	dmi := func(name string) string {
+		return dmiValue(readLine(filepath.Join(root, "sys/class/dmi/id", name)))
+	}
+	inv := Inventory{
+		Manufacturer:   dmi("sys_vendor"),
+		ProductName:    dmi("product_name"),
+		ProductVersion: dmi("product_version"),
+		// The serial number and UUID are only readable by root; see
+		// ReadSerials
+		SerialNumber: dmi("product_serial"),
+		UUID:         dmi("product_uuid"),
+		BIOSVendor:   dmi("bios_vendor"),
+		BIOSVersion:  dmi("bios_version"),
+		BoardName:    dmi("board_name"),
+	}
+
+	inv.MemoryKB = memTotal(filepath.Join(root, "proc/meminfo"))
+	inv.RAM = Unknown
+	if inv.MemoryKB > 0 {
+		// MemTotal is a little less than what is installed, as the kernel
+		// and firmware reserve some
+		const gb = 1024 * 1024
+		inv.RAM = fmt.Sprintf("%d GB", (inv.MemoryKB+gb-1)/gb)
+	}
+
+	inv.CPUFamily, inv.CPUModel, inv.CPUs = cpuInfo(filepath.Join(root, "proc/cpuinfo"))
+	inv.Disks = disks(filepath.Join(root, "sys/block"))
+	inv.Links = links(filepath.Join(root, "sys/class/net"))
+	inv.Displays = displays(filepath.Join(root, "sys/class/drm"))
+	inv.USB = usbDevices(filepath.Join(root, "sys/bus/usb/devices"))
+	inv.Batteries = batteries(filepath.Join(root, "sys/class/power_supply"))
+
+	inv.OS = osRelease(filepath.Join(root, "etc/os-release"))
+	if inv.OS == Unknown {
+		inv.OS = osRelease(filepath.Join(root, "usr/lib/os-release"))
+	}
+	inv.Kernel = readLine(filepath.Join(root, "proc/sys/kernel/osrelease"))
+	if inv.Kernel == "" {
+		inv.Kernel = Unknown
+	}
+	inv.ImageVersion = Unknown
+	return inv
+}
+
+// ReadImageVersion sets ImageVersion from the first line of file, if it
+// exists.
+func (inv *Inventory) ReadImageVersion(file string) {
+	if v := readLine(file); v != "" {
+		inv.ImageVersion = v
+	}
+}
+
+// ReadSerials reads the DMI serial number and UUID with sudo -n cat, if
+// Read couldn't read them. Nothing is done if sudo is empty.
+func (inv *Inventory) ReadSerials(root, sudo string) {
+	if sudo == "" {
+		return
+	}
+	cat := func(name string) string {
+		output, err := exec.Command(sudo, "-n", "cat", filepath.Join(root, "sys/class/dmi/id", name)).Output()
+		if err != nil {
+			return Unknown
+		}
+		return dmiValue(strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]))
+	}
+	if inv.SerialNumber == Unknown {
+		inv.SerialNumber = cat("product_serial")
+	}
+	if inv.UUID == Unknown {
+		inv.UUID = cat("product_uuid")
+	}
+}
+
+// osRelease returns PRETTY_NAME from an os-release file.
+func osRelease(file string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Unknown
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "PRETTY_NAME=") {
+			if name := strings.Trim(line[len("PRETTY_NAME="):], `"'`); name != "" {
+				return name
+			}
+		}
+	}
+	return Unknown
+}
+
+// readLine returns the first line of file, or "" if it can't be read.
+func readLine(file string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	line := strings.SplitN(string(b), "\n", 2)[0]
+	return strings.TrimSpace(line)
+}
+
+// readInt returns the integer in file, or 0.
+func readInt(file string) int64 {
+	n, _ := strconv.ParseInt(readLine(file), 10, 64)
+	return n
+}
+
+// dmiValue returns s, or Unknown if it is empty or a placeholder.
+func dmiValue(s string) string {
+	lower := strings.ToLower(s)
+	for _, p := range placeholders {
+		if lower == p {
+			return Unknown
+		}
+	}
+	return s
+}
+
+// memTotal returns MemTotal from /proc/meminfo, in kB.
+func memTotal(file string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// MemTotal:        8052348 kB
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.Atoi(fields[1])
+			return kb
+		}
+	}
+	return 0
+}
+
+// cpuInfo returns the CPU family and model name of the first processor in
+// /proc/cpuinfo, and the number of processors.
+func cpuInfo(file string) (family, model string, cpus int) {
+	family, model = Unknown, Unknown
+	f, err := os.Open(file)
+	if err != nil {
+		return family, model, 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		i := strings.Index(s.Text(), ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(s.Text()[:i])
+		value := strings.TrimSpace(s.Text()[i+1:])
+		switch {
+		case key == "processor":
+			cpus++
+		case cpus > 1:
+			// Only the first processor is described
+		case key == "cpu family" && value != "":
+			family = value
+		case key == "model name" && value != "":
+			model = value
+		}
+	}
+	return family, model, cpus
+}
@@ -0,0 +1,120 @@
+package inventory
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	got := Read("testdata/full")
+	want := Inventory{
+		Manufacturer:   "LENOVO",
+		ProductName:    "20HR0021MX",
+		ProductVersion: "ThinkPad T470",
+		SerialNumber:   "PF0XXXXX",
+		UUID:           "5C2A9B3E-1D2F-4A8B-9C7D-0E1F2A3B4C5D",
+		RAM:            "8 GB",
+		CPUFamily:      "6",
+		BIOSVendor:     "LENOVO",
+		BIOSVersion:    "N1QET98W (1.73 )",
+		BoardName:      Unknown,
+		MemoryKB:       7952348,
+		CPUModel:       "Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz",
+		CPUs:           4,
+		Disks: []Disk{
+			{Name: "sda", Model: "SAMSUNG MZ7LN256", Bytes: 256060514304, Serial: "S3PZNX0J", Health: Unknown},
+			{Name: "sdb", Model: "Cruzer Blade", Bytes: 16008609792, Rotational: true, Removable: true, Health: Unknown},
+		},
+		Links: []Link{
+			{Name: "enp0s31f6", MAC: "54:e1:ad:00:11:22"},
+			{Name: "wlp4s0", MAC: "00:28:f8:33:44:55", Wireless: true},
+		},
+		Displays: []Display{
+			{Connector: "HDMI-A-1", Manufacturer: "DEL", Model: "DELL P2419H", Serial: "CFV9N99S0L1U", Resolution: "1920x1080"},
+		},
+		USB: []USBDevice{
+			{Bus: "1-1", VendorID: "046d", ProductID: "c31c", Manufacturer: "Logitech", Product: "USB Keyboard"},
+			{Bus: "1-2", VendorID: "0bda", ProductID: "0129", Manufacturer: Unknown, Product: Unknown, Serial: "20100201396000000"},
+		},
+		Batteries: []Battery{
+			{Name: "BAT0", Model: "01AV421", Health: 80, CycleCount: 112},
+		},
+		OS:           "Debian GNU/Linux 12 (bookworm)",
+		Kernel:       "6.1.0-18-amd64",
+		ImageVersion: Unknown,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestReadUnknown(t *testing.T) {
+	got := Read("testdata/sparse")
+	want := Inventory{
+		Manufacturer:   "QEMU",
+		ProductName:    Unknown,
+		ProductVersion: Unknown,
+		SerialNumber:   Unknown,
+		UUID:           Unknown,
+		RAM:            Unknown,
+		CPUFamily:      Unknown,
+		BIOSVendor:     Unknown,
+		BIOSVersion:    Unknown,
+		BoardName:      Unknown,
+		CPUModel:       Unknown,
+		CPUs:           1,
+		Disks:          []Disk{{Name: "vda", Model: Unknown, Health: Unknown}},
+		Links:          []Link{{Name: "eth0", MAC: Unknown}},
+		Displays: []Display{
+			{Connector: "Virtual-1", Manufacturer: Unknown, Model: Unknown, Serial: Unknown, Resolution: Unknown},
+		},
+		USB:          []USBDevice{{Bus: "2-1", VendorID: "0627", ProductID: "0001", Manufacturer: Unknown, Product: Unknown}},
+		Batteries:    []Battery{{Name: "BAT1", Model: Unknown}},
+		OS:           "Ubuntu 22.04.4 LTS",
+		Kernel:       Unknown,
+		ImageVersion: Unknown,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Nothing at all to read
+	got = Read(t.TempDir())
+	want = Inventory{
+		Manufacturer: Unknown, ProductName: Unknown, ProductVersion: Unknown,
+		SerialNumber: Unknown, UUID: Unknown, RAM: Unknown, CPUFamily: Unknown,
+		BIOSVendor: Unknown, BIOSVersion: Unknown, BoardName: Unknown,
+		CPUModel: Unknown, OS: Unknown, Kernel: Unknown, ImageVersion: Unknown,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() of empty root =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestReadSerials(t *testing.T) {
+	sudo, err := filepath.Abs("testdata/sudo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := Inventory{SerialNumber: Unknown, UUID: "from sysfs"}
+	inv.ReadSerials("testdata/full", "")
+	if inv.SerialNumber != Unknown {
+		t.Errorf("serial number read without sudo: %s", inv.SerialNumber)
+	}
+	inv.ReadSerials("testdata/full", sudo)
+	if inv.SerialNumber != "PF0XXXXX" || inv.UUID != "from sysfs" {
+		t.Errorf("got serial number %s and UUID %s", inv.SerialNumber, inv.UUID)
+	}
+
+	// Placeholders and unreadable files stay unknown
+	inv = Inventory{SerialNumber: Unknown, UUID: Unknown}
+	inv.ReadSerials("testdata/sparse", sudo)
+	if inv.SerialNumber != Unknown || inv.UUID != Unknown {
+		t.Errorf("got serial number %s and UUID %s", inv.SerialNumber, inv.UUID)
+	}
+	inv.ReadSerials(t.TempDir(), sudo)
+	if inv.SerialNumber != Unknown || inv.UUID != Unknown {
+		t.Errorf("got serial number %s and UUID %s", inv.SerialNumber, inv.UUID)
+	}
+}
@@ -0,0 +1,49 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Battery describes a battery. The charge level and whether it is charging
+// are left out, as they change all the time.
+type Battery struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	Health     int    `json:"health"` // full charge, in percent of the design capacity
+	CycleCount int    `json:"cycle_count"`
+}
+
+// batteries lists the batteries in /sys/class/power_supply.
+func batteries(dir string) []Battery {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var batteries []Battery
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if readLine(filepath.Join(path, "type")) != "Battery" {
+			continue
+		}
+		b := Battery{
+			Name:       e.Name(),
+			Model:      readLine(filepath.Join(path, "model_name")),
+			CycleCount: int(readInt(filepath.Join(path, "cycle_count"))),
+		}
+		if b.Model == "" {
+			b.Model = Unknown
+		}
+		// Batteries report either energy (µWh) or charge (µAh)
+		for _, unit := range []string{"energy", "charge"} {
+			full := readInt(filepath.Join(path, unit+"_full"))
+			design := readInt(filepath.Join(path, unit+"_full_design"))
+			if full > 0 && design > 0 {
+				b.Health = int(full * 100 / design)
+				break
+			}
+		}
+		batteries = append(batteries, b)
+	}
+	return batteries
+}
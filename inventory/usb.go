@@ -0,0 +1,53 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// USBDevice is a device attached to a USB port, like a keyboard or a card
+// reader. Hubs are left out.
+type USBDevice struct {
+	Bus          string `json:"bus"` // e.g. "1-1.2"
+	VendorID     string `json:"vendor_id"`
+	ProductID    string `json:"product_id"`
+	Manufacturer string `json:"manufacturer"`
+	Product      string `json:"product"`
+	Serial       string `json:"serial,omitempty"`
+}
+
+// hubClass is the USB device class of hubs.
+const hubClass = "09"
+
+// usbDevices lists the devices in /sys/bus/usb/devices. Interfaces, which
+// are listed there as well, have no idVendor file.
+func usbDevices(dir string) []USBDevice {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var devices []USBDevice
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		vendor := readLine(filepath.Join(path, "idVendor"))
+		if vendor == "" || readLine(filepath.Join(path, "bDeviceClass")) == hubClass {
+			continue
+		}
+		d := USBDevice{
+			Bus:          e.Name(),
+			VendorID:     vendor,
+			ProductID:    readLine(filepath.Join(path, "idProduct")),
+			Manufacturer: readLine(filepath.Join(path, "manufacturer")),
+			Product:      readLine(filepath.Join(path, "product")),
+			Serial:       readLine(filepath.Join(path, "serial")),
+		}
+		if d.Manufacturer == "" {
+			d.Manufacturer = Unknown
+		}
+		if d.Product == "" {
+			d.Product = Unknown
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
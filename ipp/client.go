@@ -0,0 +1,196 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultAddr is the CUPS domain socket on most Linux distributions.
+const DefaultAddr = "/run/cups/cups.sock"
+
+// Client talks to a CUPS server. The zero value uses DefaultAddr. A Client
+// may be used from several goroutines, but must not be copied.
+//
+// Over the domain socket, CUPS authenticates the user by its peer
+// credentials, so no password is needed. The user must still be allowed to
+// administer CUPS, usually by being in one of the SystemGroup groups in
+// cups-files.conf, like lpadmin.
+type Client struct {
+	// Addr is the path of the CUPS domain socket, or host:port, like
+	// localhost:631.
+	Addr string
+	// User is sent as requesting-user-name; by default the current user.
+	User string
+
+	httpOnce  sync.Once
+	http      *http.Client
+	requestID uint32
+}
+
+func (c *Client) addr() string {
+	if c.Addr == "" {
+		return DefaultAddr
+	}
+	return c.Addr
+}
+
+// local reports whether the client talks to CUPS over a domain socket.
+func (c *Client) local() bool {
+	return strings.HasPrefix(c.addr(), "/")
+}
+
+func (c *Client) user() string {
+	if c.User != "" {
+		return c.User
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "root"
+}
+
+func (c *Client) httpClient() *http.Client {
+	c.httpOnce.Do(func() {
+		if !c.local() {
+			c.http = http.DefaultClient
+			return
+		}
+		var d net.Dialer
+		c.http = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", c.addr())
+			},
+		}}
+	})
+	return c.http
+}
+
+// printerURI returns the URI CUPS knows the named printer by.
+func printerURI(name string) string {
+	return "ipp://localhost/printers/" + url.PathEscape(name)
+}
+
+// Do sends an operation to the resource at path, e.g. "/admin/", with the
+// given operation attributes, following the required charset, language and
+// user attributes, and any further attribute groups. Unsuccessful statuses
+// are returned as *Error.
+func (c *Client) Do(ctx context.Context, op Operation, path string, attrs []Attribute, groups ...Group) (*Message, error) {
+	operation := Group{Tag: TagOperation, Attrs: []Attribute{
+		String(TagCharset, "attributes-charset", "utf-8"),
+		String(TagNaturalLanguage, "attributes-natural-language", "en"),
+	}}
+	operation.Attrs = append(operation.Attrs, attrs...)
+	operation.Attrs = append(operation.Attrs, String(TagName, "requesting-user-name", c.user()))
+	req := &Message{
+		Code:      uint16(op),
+		RequestID: atomic.AddUint32(&c.requestID, 1),
+		Groups:    append([]Group{operation}, groups...),
+	}
+	var body bytes.Buffer
+	if err := req.Encode(&body); err != nil {
+		return nil, err
+	}
+
+	host := c.addr()
+	if c.local() {
+		host = "localhost"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", "http://"+host+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+	if c.local() {
+		httpReq.Header.Set("Authorization", "PeerCred "+c.user())
+	}
+	resp, err := c.httpClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{Op: op, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	m, err := Decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if status := Status(m.Code); !status.Successful() {
+		e := &Error{Op: op, Status: status}
+		for _, g := range m.Groups {
+			if g.Tag == TagOperation {
+				e.Message = g.GetString("status-message")
+			}
+		}
+		return nil, e
+	}
+	return m, nil
+}
+
+// AddModifyPrinter adds the named printer, or modifies it if it exists,
+// with the given printer attributes, e.g. device-uri and ppd-name.
+func (c *Client) AddModifyPrinter(ctx context.Context, name string, attrs []Attribute) error {
+	_, err := c.Do(ctx, OpCUPSAddModifyPrinter, "/admin/",
+		[]Attribute{String(TagURI, "printer-uri", printerURI(name))},
+		Group{Tag: TagPrinter, Attrs: attrs})
+	return err
+}
+
+// DeletePrinter deletes the named printer.
+func (c *Client) DeletePrinter(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, OpCUPSDeletePrinter, "/admin/",
+		[]Attribute{String(TagURI, "printer-uri", printerURI(name))})
+	return err
+}
+
+// SetDefault makes the named printer the server's default destination.
+func (c *Client) SetDefault(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, OpCUPSSetDefault, "/admin/",
+		[]Attribute{String(TagURI, "printer-uri", printerURI(name))})
+	return err
+}
+
+// Default returns the name of the default destination. If there is none,
+// the error is an Error with StatusNotFound.
+func (c *Client) Default(ctx context.Context) (string, error) {
+	m, err := c.Do(ctx, OpCUPSGetDefault, "/",
+		[]Attribute{String(TagKeyword, "requested-attributes", "printer-name")})
+	if err != nil {
+		return "", err
+	}
+	for _, g := range m.Groups {
+		if g.Tag == TagPrinter {
+			return g.GetString("printer-name"), nil
+		}
+	}
+	return "", &Error{Op: OpCUPSGetDefault, Status: StatusNotFound}
+}
+
+// Printers returns the printers known to the server, mapped to their
+// device URIs.
+func (c *Client) Printers(ctx context.Context) (map[string]string, error) {
+	m, err := c.Do(ctx, OpCUPSGetPrinters, "/",
+		[]Attribute{String(TagKeyword, "requested-attributes", "printer-name", "device-uri")})
+	if err != nil {
+		// CUPS answers not-found when there are no printers at all
+		if IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	printers := make(map[string]string)
+	for _, g := range m.Groups {
+		if g.Tag == TagPrinter {
+			printers[g.GetString("printer-name")] = g.GetString("device-uri")
+		}
+	}
+	return printers, nil
+}
@@ -0,0 +1,223 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// request is a request received by the stand-in CUPS server.
+type request struct {
+	path    string
+	auth    string
+	message *Message
+}
+
+// cupsServer is a stand-in CUPS server, which records the requests and
+// answers them with respond.
+type cupsServer struct {
+	*httptest.Server
+	requests chan request
+	respond  func(req *Message) *Message
+}
+
+func newServer(t *testing.T, respond func(req *Message) *Message) *cupsServer {
+	s := &cupsServer{requests: make(chan request, 10), respond: respond}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *cupsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Header.Get("Content-Type") != "application/ipp" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	m, err := Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests <- request{path: r.URL.Path, auth: r.Header.Get("Authorization"), message: m}
+	resp := s.respond(m)
+	resp.RequestID = m.RequestID
+	var b bytes.Buffer
+	resp.Encode(&b)
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Write(b.Bytes())
+}
+
+// client returns a client talking to the server over TCP.
+func (s *cupsServer) client() *Client {
+	return &Client{Addr: strings.TrimPrefix(s.URL, "http://"), User: "kiosk"}
+}
+
+// ok answers successfully, with the given groups after the operation group.
+func ok(groups ...Group) func(*Message) *Message {
+	return status(StatusOK, "", groups...)
+}
+
+func status(s Status, message string, groups ...Group) func(*Message) *Message {
+	return func(*Message) *Message {
+		op := Group{Tag: TagOperation, Attrs: []Attribute{
+			String(TagCharset, "attributes-charset", "utf-8"),
+			String(TagNaturalLanguage, "attributes-natural-language", "en"),
+		}}
+		if message != "" {
+			op.Attrs = append(op.Attrs, String(TagText, "status-message", message))
+		}
+		return &Message{Code: uint16(s), Groups: append([]Group{op}, groups...)}
+	}
+}
+
+// wantRequest checks the next request the server got, and returns its
+// groups after the operation group.
+func wantRequest(t *testing.T, s *cupsServer, op Operation, path string, attrs ...Attribute) []Group {
+	t.Helper()
+	req := <-s.requests
+	if Operation(req.message.Code) != op || req.path != path {
+		t.Fatalf("got %s to %s, want %s to %s", Operation(req.message.Code), req.path, op, path)
+	}
+	want := []Attribute{
+		String(TagCharset, "attributes-charset", "utf-8"),
+		String(TagNaturalLanguage, "attributes-natural-language", "en"),
+	}
+	want = append(want, attrs...)
+	want = append(want, String(TagName, "requesting-user-name", "kiosk"))
+	if len(req.message.Groups) == 0 || !reflect.DeepEqual(req.message.Groups[0].Attrs, want) {
+		t.Errorf("%s operation attributes = %+v, want %+v", op, req.message.Groups, want)
+		return nil
+	}
+	return req.message.Groups[1:]
+}
+
+func TestAddModifyPrinter(t *testing.T) {
+	s := newServer(t, ok())
+	attrs := []Attribute{
+		String(TagURI, "device-uri", "socket://10.0.0.5:9100"),
+		String(TagName, "ppd-name", "drv:///sample.drv/generic.ppd"),
+		Boolean("printer-is-accepting-jobs", true),
+	}
+	if err := s.client().AddModifyPrinter(context.Background(), "kontor", attrs); err != nil {
+		t.Fatal(err)
+	}
+	groups := wantRequest(t, s, OpCUPSAddModifyPrinter, "/admin/",
+		String(TagURI, "printer-uri", "ipp://localhost/printers/kontor"))
+	if want := []Group{{Tag: TagPrinter, Attrs: attrs}}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("printer attributes = %+v, want %+v", groups, want)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	s := newServer(t, ok())
+	if err := s.client().SetDefault(context.Background(), "blå skriver"); err != nil {
+		t.Fatal(err)
+	}
+	wantRequest(t, s, OpCUPSSetDefault, "/admin/",
+		String(TagURI, "printer-uri", "ipp://localhost/printers/bl%C3%A5%20skriver"))
+}
+
+func TestCancelJob(t *testing.T) {
+	s := newServer(t, ok())
+	if err := s.client().CancelJob(context.Background(), 17); err != nil {
+		t.Fatal(err)
+	}
+	wantRequest(t, s, OpCancelJob, "/jobs/", String(TagURI, "job-uri", "ipp://localhost/jobs/17"))
+}
+
+func TestDefault(t *testing.T) {
+	s := newServer(t, ok(Group{Tag: TagPrinter, Attrs: []Attribute{String(TagName, "printer-name", "kontor")}}))
+	name, err := s.client().Default(context.Background())
+	if err != nil || name != "kontor" {
+		t.Errorf("Default() = %q, %v, want kontor", name, err)
+	}
+
+	s = newServer(t, ok())
+	if _, err := s.client().Default(context.Background()); !IsNotFound(err) {
+		t.Errorf("Default() without default = %v, want not found", err)
+	}
+}
+
+func TestPrinters(t *testing.T) {
+	s := newServer(t, ok(
+		Group{Tag: TagPrinter, Attrs: []Attribute{
+			String(TagName, "printer-name", "kontor"),
+			String(TagURI, "device-uri", "ipp://printer.example/ipp/print"),
+		}},
+		Group{Tag: TagPrinter, Attrs: []Attribute{
+			String(TagName, "printer-name", "publikumsskriver"),
+			String(TagURI, "device-uri", "socket://10.0.0.5:9100"),
+		}},
+	))
+	printers, err := s.client().Printers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"kontor":           "ipp://printer.example/ipp/print",
+		"publikumsskriver": "socket://10.0.0.5:9100",
+	}
+	if !reflect.DeepEqual(printers, want) {
+		t.Errorf("Printers() = %v, want %v", printers, want)
+	}
+
+	// CUPS answers not-found when there are no printers
+	s = newServer(t, status(StatusNotFound, "No destinations added."))
+	printers, err = s.client().Printers(context.Background())
+	if err != nil || len(printers) != 0 {
+		t.Errorf("Printers() without printers = %v, %v", printers, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newServer(t, status(StatusNotFound, "The printer or class does not exist."))
+	err := s.client().DeletePrinter(context.Background(), "kontor")
+	if !IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("DeletePrinter() = %v, want not found", err)
+	}
+	want := "ipp: CUPS-Delete-Printer: client-error-not-found: The printer or class does not exist."
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+
+	s = newServer(t, status(StatusForbidden, ""))
+	if err := s.client().HoldJob(context.Background(), 1); !IsUnauthorized(err) || IsNotFound(err) {
+		t.Errorf("HoldJob() = %v, want unauthorized", err)
+	}
+
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+	c := &Client{Addr: strings.TrimPrefix(unauthorized.URL, "http://")}
+	if err := c.SetDefault(context.Background(), "kontor"); !IsUnauthorized(err) {
+		t.Errorf("SetDefault() = %v, want unauthorized", err)
+	}
+}
+
+func TestDomainSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "cups.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &cupsServer{requests: make(chan request, 10), respond: ok()}
+	s.Server = httptest.NewUnstartedServer(s)
+	s.Listener = ln
+	s.Start()
+	defer s.Close()
+
+	c := &Client{Addr: sock, User: "kiosk"}
+	if err := c.ReleaseJob(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-s.requests; req.auth != "PeerCred kiosk" {
+		t.Errorf("Authorization = %q, want PeerCred kiosk", req.auth)
+	}
+}
@@ -0,0 +1,112 @@
+package ipp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is an IPP status code.
+type Status uint16
+
+// Status codes, from RFC 8011 and CUPS.
+const (
+	StatusOK                     Status = 0x0000
+	StatusOKIgnoredOrSubstituted Status = 0x0001
+	StatusOKConflicting          Status = 0x0002
+	StatusBadRequest             Status = 0x0400
+	StatusForbidden              Status = 0x0401
+	StatusNotAuthenticated       Status = 0x0402
+	StatusNotAuthorized          Status = 0x0403
+	StatusNotPossible            Status = 0x0404
+	StatusTimeout                Status = 0x0405
+	StatusNotFound               Status = 0x0406
+	StatusGone                   Status = 0x0407
+	StatusAttributesOrValues     Status = 0x040B
+	StatusInternalError          Status = 0x0500
+	StatusOperationNotSupported  Status = 0x0501
+	StatusServiceUnavailable     Status = 0x0502
+	StatusVersionNotSupported    Status = 0x0503
+	StatusDeviceError            Status = 0x0504
+	StatusNotAcceptingJobs       Status = 0x0506
+	StatusBusy                   Status = 0x0507
+)
+
+var statusNames = map[Status]string{
+	StatusOK:                     "successful-ok",
+	StatusOKIgnoredOrSubstituted: "successful-ok-ignored-or-substituted-attributes",
+	StatusOKConflicting:          "successful-ok-conflicting-attributes",
+	StatusBadRequest:             "client-error-bad-request",
+	StatusForbidden:              "client-error-forbidden",
+	StatusNotAuthenticated:       "client-error-not-authenticated",
+	StatusNotAuthorized:          "client-error-not-authorized",
+	StatusNotPossible:            "client-error-not-possible",
+	StatusTimeout:                "client-error-timeout",
+	StatusNotFound:               "client-error-not-found",
+	StatusGone:                   "client-error-gone",
+	StatusAttributesOrValues:     "client-error-attributes-or-values-not-supported",
+	StatusInternalError:          "server-error-internal-error",
+	StatusOperationNotSupported:  "server-error-operation-not-supported",
+	StatusServiceUnavailable:     "server-error-service-unavailable",
+	StatusVersionNotSupported:    "server-error-version-not-supported",
+	StatusDeviceError:            "server-error-device-error",
+	StatusNotAcceptingJobs:       "server-error-not-accepting-jobs",
+	StatusBusy:                   "server-error-busy",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("status 0x%04x", uint16(s))
+}
+
+// Successful reports whether s is one of the successful-ok statuses.
+func (s Status) Successful() bool {
+	return s < 0x0100
+}
+
+// Error is returned when the server answers an operation with an
+// unsuccessful status.
+type Error struct {
+	Op      Operation
+	Status  Status
+	Message string // the status-message from the server, if any
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ipp: %s: %s: %s", e.Op, e.Status, e.Message)
+	}
+	return fmt.Sprintf("ipp: %s: %s", e.Op, e.Status)
+}
+
+// HTTPError is returned when the server rejects a request at the HTTP
+// level, typically with 401 Unauthorized or 403 Forbidden when the user
+// isn't allowed to administer CUPS.
+type HTTPError struct {
+	Op         Operation
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("ipp: %s: %s", e.Op, e.Status)
+}
+
+// IsNotFound reports whether err is an Error with StatusNotFound, e.g. when
+// a printer doesn't exist.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == StatusNotFound
+}
+
+// IsUnauthorized reports whether err means the user isn't allowed to
+// perform the operation.
+func IsUnauthorized(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status == StatusForbidden || e.Status == StatusNotAuthenticated || e.Status == StatusNotAuthorized
+	}
+	var h *HTTPError
+	return errors.As(err, &h) && (h.StatusCode == 401 || h.StatusCode == 403)
+}
@@ -0,0 +1,273 @@
+// Package ipp is a small IPP client for administering the local CUPS
+// server. It implements just enough of RFC 8010 and the CUPS extensions to
+// add, modify, delete and list printer queues, to set the default
+// destination, and to list, hold, release and cancel the user's jobs.
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// version is the IPP version used in requests, 2.0.
+const version = 0x0200
+
+// Delimiter tags, which start attribute groups.
+const (
+	TagOperation = 0x01
+	TagJob       = 0x02
+	TagEnd       = 0x03
+	TagPrinter   = 0x04
+)
+
+// Value tags.
+const (
+	TagInteger         = 0x21
+	TagBoolean         = 0x22
+	TagEnum            = 0x23
+	TagText            = 0x41
+	TagName            = 0x42
+	TagKeyword         = 0x44
+	TagURI             = 0x45
+	TagCharset         = 0x47
+	TagNaturalLanguage = 0x48
+	TagMimeMediaType   = 0x49
+)
+
+// Operation is an IPP operation id.
+type Operation uint16
+
+// Operations used by this package.
+const (
+	OpCancelJob            Operation = 0x0008
+	OpGetJobs              Operation = 0x000A
+	OpHoldJob              Operation = 0x000C
+	OpReleaseJob           Operation = 0x000D
+	OpCUPSGetDefault       Operation = 0x4001
+	OpCUPSGetPrinters      Operation = 0x4002
+	OpCUPSAddModifyPrinter Operation = 0x4003
+	OpCUPSDeletePrinter    Operation = 0x4004
+	OpCUPSSetDefault       Operation = 0x400A
+)
+
+var operationNames = map[Operation]string{
+	OpCancelJob:            "Cancel-Job",
+	OpGetJobs:              "Get-Jobs",
+	OpHoldJob:              "Hold-Job",
+	OpReleaseJob:           "Release-Job",
+	OpCUPSGetDefault:       "CUPS-Get-Default",
+	OpCUPSGetPrinters:      "CUPS-Get-Printers",
+	OpCUPSAddModifyPrinter: "CUPS-Add-Modify-Printer",
+	OpCUPSDeletePrinter:    "CUPS-Delete-Printer",
+	OpCUPSSetDefault:       "CUPS-Set-Default",
+}
+
+func (op Operation) String() string {
+	if name, ok := operationNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("operation 0x%04x", uint16(op))
+}
+
+// Attribute is a named attribute with one or more values. Values are int
+// for integers and enums, bool for booleans and string for the text types.
+// Other values are kept as []byte.
+type Attribute struct {
+	Name   string
+	Tag    byte
+	Values []interface{}
+}
+
+// String returns a text attribute with the given value tag, e.g. TagURI.
+func String(tag byte, name string, values ...string) Attribute {
+	a := Attribute{Name: name, Tag: tag}
+	for _, v := range values {
+		a.Values = append(a.Values, v)
+	}
+	return a
+}
+
+// Integer returns an integer attribute.
+func Integer(name string, v int) Attribute {
+	return Attribute{Name: name, Tag: TagInteger, Values: []interface{}{v}}
+}
+
+// Enum returns an enum attribute.
+func Enum(name string, v int) Attribute {
+	return Attribute{Name: name, Tag: TagEnum, Values: []interface{}{v}}
+}
+
+// Boolean returns a boolean attribute.
+func Boolean(name string, v bool) Attribute {
+	return Attribute{Name: name, Tag: TagBoolean, Values: []interface{}{v}}
+}
+
+// Group is a group of attributes, like the operation or printer attributes.
+type Group struct {
+	Tag   byte
+	Attrs []Attribute
+}
+
+// Get returns the first value of the named attribute, or nil.
+func (g Group) Get(name string) interface{} {
+	for _, a := range g.Attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			return a.Values[0]
+		}
+	}
+	return nil
+}
+
+// GetString returns the first value of the named attribute if it is text,
+// and "" otherwise.
+func (g Group) GetString(name string) string {
+	s, _ := g.Get(name).(string)
+	return s
+}
+
+// Message is an IPP request or response. Code is the operation id in
+// requests and the status code in responses.
+type Message struct {
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// Encode writes the message in the IPP wire format.
+func (m *Message) Encode(w io.Writer) error {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(version))
+	binary.Write(&b, binary.BigEndian, m.Code)
+	binary.Write(&b, binary.BigEndian, m.RequestID)
+	for _, g := range m.Groups {
+		b.WriteByte(g.Tag)
+		for _, a := range g.Attrs {
+			if len(a.Values) == 0 {
+				return fmt.Errorf("ipp: attribute %s has no value", a.Name)
+			}
+			for i, v := range a.Values {
+				name := a.Name
+				if i > 0 {
+					// Additional values have no name
+					name = ""
+				}
+				data, err := encodeValue(a.Tag, v)
+				if err != nil {
+					return fmt.Errorf("ipp: attribute %s: %v", a.Name, err)
+				}
+				if len(name) > 0xFFFF || len(data) > 0xFFFF {
+					return fmt.Errorf("ipp: attribute %s too long", a.Name)
+				}
+				b.WriteByte(a.Tag)
+				binary.Write(&b, binary.BigEndian, uint16(len(name)))
+				b.WriteString(name)
+				binary.Write(&b, binary.BigEndian, uint16(len(data)))
+				b.Write(data)
+			}
+		}
+	}
+	b.WriteByte(TagEnd)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func encodeValue(tag byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case int:
+		if tag != TagInteger && tag != TagEnum {
+			break
+		}
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(v)))
+		return b, nil
+	case bool:
+		if tag != TagBoolean {
+			break
+		}
+		if v {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("can't encode %T with tag 0x%02x", v, tag)
+}
+
+// errMalformed is returned when a message can't be decoded.
+var errMalformed = errors.New("ipp: malformed message")
+
+// Decode reads a message in the IPP wire format.
+func Decode(r io.Reader) (*Message, error) {
+	var header struct {
+		Version   uint16
+		Code      uint16
+		RequestID uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, errMalformed
+	}
+	m := &Message{Code: header.Code, RequestID: header.RequestID}
+
+	var g *Group
+	var tag [1]byte
+	for {
+		if _, err := io.ReadFull(r, tag[:]); err != nil {
+			return nil, errMalformed
+		}
+		t := tag[0]
+		if t == TagEnd {
+			return m, nil
+		}
+		if t < 0x10 {
+			// 0x00-0x0f are delimiter tags
+			m.Groups = append(m.Groups, Group{Tag: t})
+			g = &m.Groups[len(m.Groups)-1]
+			continue
+		}
+		name, err := readField(r)
+		if err != nil || g == nil {
+			return nil, errMalformed
+		}
+		data, err := readField(r)
+		if err != nil {
+			return nil, errMalformed
+		}
+		v := decodeValue(t, data)
+		if len(name) == 0 && len(g.Attrs) > 0 {
+			// An additional value of the previous attribute
+			last := &g.Attrs[len(g.Attrs)-1]
+			last.Values = append(last.Values, v)
+			continue
+		}
+		g.Attrs = append(g.Attrs, Attribute{Name: string(name), Tag: t, Values: []interface{}{v}})
+	}
+}
+
+// readField reads a length-prefixed field.
+func readField(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func decodeValue(tag byte, data []byte) interface{} {
+	switch {
+	case (tag == TagInteger || tag == TagEnum) && len(data) == 4:
+		return int(int32(binary.BigEndian.Uint32(data)))
+	case tag == TagBoolean && len(data) == 1:
+		return data[0] != 0
+	case tag >= 0x41 && tag <= 0x49:
+		return string(data)
+	}
+	return data
+}
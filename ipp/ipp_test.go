@@ -0,0 +1,100 @@
+package ipp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	m := &Message{
+		Code:      uint16(OpCUPSAddModifyPrinter),
+		RequestID: 42,
+		Groups: []Group{
+			{Tag: TagOperation, Attrs: []Attribute{
+				String(TagCharset, "attributes-charset", "utf-8"),
+				String(TagURI, "printer-uri", "ipp://localhost/printers/kontor"),
+			}},
+			{Tag: TagPrinter, Attrs: []Attribute{
+				String(TagURI, "device-uri", "socket://10.0.0.5:9100"),
+				String(TagText, "printer-location", "2. etasje"),
+				String(TagName, "job-sheets-default", "none", "standard"),
+				Integer("job-page-limit", 100),
+				Integer("negative", -1),
+				Enum("printer-state", 3),
+				Boolean("printer-is-accepting-jobs", true),
+				Boolean("printer-is-shared", false),
+				{Name: "octets", Tag: 0x30, Values: []interface{}{[]byte{0, 1, 2}}},
+			}},
+			{Tag: TagJob},
+		},
+	}
+	var b bytes.Buffer
+	if err := m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("decoded %+v, want %+v", got, m)
+	}
+}
+
+func TestEncodeWire(t *testing.T) {
+	m := &Message{
+		Code:      uint16(OpCUPSSetDefault),
+		RequestID: 1,
+		Groups: []Group{{Tag: TagOperation, Attrs: []Attribute{
+			String(TagKeyword, "k", "a", "b"),
+		}}},
+	}
+	var b bytes.Buffer
+	if err := m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x02, 0x00, // version 2.0
+		0x40, 0x0A, // CUPS-Set-Default
+		0, 0, 0, 1, // request id
+		TagOperation,
+		TagKeyword, 0, 1, 'k', 0, 1, 'a',
+		TagKeyword, 0, 0, 0, 1, 'b', // additional value, without name
+		TagEnd,
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("encoded % x, want % x", b.Bytes(), want)
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	attrs := []Attribute{
+		{Name: "empty", Tag: TagKeyword},
+		{Name: "mismatch", Tag: TagKeyword, Values: []interface{}{1}},
+		{Name: "unknown", Tag: TagInteger, Values: []interface{}{1.5}},
+		String(TagText, "long", string(make([]byte, 0x10000))),
+	}
+	for _, a := range attrs {
+		m := &Message{Groups: []Group{{Tag: TagOperation, Attrs: []Attribute{a}}}}
+		if err := m.Encode(&bytes.Buffer{}); err == nil {
+			t.Errorf("encoded invalid attribute %s", a.Name)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	messages := [][]byte{
+		{},
+		{0x02, 0x00, 0x00, 0x00},
+		{0x02, 0x00, 0x00, 0x00, 0, 0, 0, 1}, // no end tag
+		{0x02, 0x00, 0x00, 0x00, 0, 0, 0, 1, TagKeyword, 0, 1, 'k', 0, 1, 'a', TagEnd}, // no group
+		{0x02, 0x00, 0x00, 0x00, 0, 0, 0, 1, TagOperation, TagKeyword, 0, 5, 'k'},      // short name
+		{0x02, 0x00, 0x00, 0x00, 0, 0, 0, 1, TagOperation, TagKeyword, 0, 1, 'k', 0, 9, 'a'},
+	}
+	for _, b := range messages {
+		if _, err := Decode(bytes.NewReader(b)); err != errMalformed {
+			t.Errorf("Decode(% x) = %v, want errMalformed", b, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ipp
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"time"
+)
+
+// JobState is the job-state of a print job.
+type JobState int
+
+// Job states, from RFC 8011.
+const (
+	JobPending           JobState = 3
+	JobHeld              JobState = 4
+	JobProcessing        JobState = 5
+	JobProcessingStopped JobState = 6
+	JobCanceled          JobState = 7
+	JobAborted           JobState = 8
+	JobCompleted         JobState = 9
+)
+
+var jobStateNames = map[JobState]string{
+	JobPending:           "pending",
+	JobHeld:              "pending-held",
+	JobProcessing:        "processing",
+	JobProcessingStopped: "processing-stopped",
+	JobCanceled:          "canceled",
+	JobAborted:           "aborted",
+	JobCompleted:         "completed",
+}
+
+func (s JobState) String() string {
+	if name, ok := jobStateNames[s]; ok {
+		return name
+	}
+	return "job-state " + strconv.Itoa(int(s))
+}
+
+// Final reports whether the job is done, one way or another.
+func (s JobState) Final() bool {
+	return s >= JobCanceled
+}
+
+// Job describes a print job.
+type Job struct {
+	ID      int
+	Printer string
+	Name    string
+	State   JobState
+	Created time.Time
+	// Impressions is the number of pages, if known up front, and 0
+	// otherwise. ImpressionsCompleted counts the pages printed so far.
+	Impressions          int
+	ImpressionsCompleted int
+}
+
+// jobAttributes are requested by Jobs.
+var jobAttributes = []string{
+	"job-id", "job-printer-uri", "job-name", "job-state", "time-at-creation",
+	"job-impressions", "job-impressions-completed",
+}
+
+// jobURI returns the URI CUPS knows the job by.
+func jobURI(id int) string {
+	return "ipp://localhost/jobs/" + strconv.Itoa(id)
+}
+
+// Jobs returns the jobs of the user, both finished and not, with ids from
+// firstID on. If firstID is 0, all jobs kept by the server are returned.
+func (c *Client) Jobs(ctx context.Context, firstID int) ([]Job, error) {
+	attrs := []Attribute{
+		String(TagURI, "printer-uri", "ipp://localhost/"),
+		String(TagKeyword, "which-jobs", "all"),
+		Boolean("my-jobs", true),
+		String(TagKeyword, "requested-attributes", jobAttributes...),
+	}
+	if firstID > 0 {
+		attrs = append(attrs, Integer("first-job-id", firstID))
+	}
+	m, err := c.Do(ctx, OpGetJobs, "/", attrs)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []Job
+	for _, g := range m.Groups {
+		if g.Tag != TagJob {
+			continue
+		}
+		j := Job{
+			Printer: path.Base(g.GetString("job-printer-uri")),
+			Name:    g.GetString("job-name"),
+		}
+		j.ID, _ = g.Get("job-id").(int)
+		state, _ := g.Get("job-state").(int)
+		j.State = JobState(state)
+		if created, ok := g.Get("time-at-creation").(int); ok {
+			j.Created = time.Unix(int64(created), 0)
+		}
+		j.Impressions, _ = g.Get("job-impressions").(int)
+		j.ImpressionsCompleted, _ = g.Get("job-impressions-completed").(int)
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// HoldJob holds a pending job, so that it isn't printed until released.
+func (c *Client) HoldJob(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, OpHoldJob, "/jobs/",
+		[]Attribute{String(TagURI, "job-uri", jobURI(id))})
+	return err
+}
+
+// ReleaseJob releases a held job, so that it is printed.
+func (c *Client) ReleaseJob(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, OpReleaseJob, "/jobs/",
+		[]Attribute{String(TagURI, "job-uri", jobURI(id))})
+	return err
+}
+
+// CancelJob cancels a job.
+func (c *Client) CancelJob(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, OpCancelJob, "/jobs/",
+		[]Attribute{String(TagURI, "job-uri", jobURI(id))})
+	return err
+}
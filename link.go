@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// link is the websocket connection to the Mycel server. It reconnects in the
+// background whenever the connection drops, and queues log-on and log-off
+// messages until they can be delivered.
+type link struct {
+	hostWS string
+	client int
+
+	// messages receives all websocket messages from the server.
+	messages chan message
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	queue  []interface{} // messages waiting to be sent
+	user   string        // logged on user, if any
+	closed bool
+}
+
+func newLink(hostWS string, client int) *link {
+	return &link{
+		hostWS:   hostWS,
+		client:   client,
+		messages: make(chan message, 10),
+	}
+}
+
+// run connects to the Mycel websocket server, and keeps reconnecting until
+// the link is closed.
+func (l *link) run() {
+	for {
+		l.mu.Lock()
+		closed := l.closed
+		l.mu.Unlock()
+		if closed {
+			return
+		}
+
+		conn, err := websocket.Dial(fmt.Sprintf("%s/subscribe/clients/%d", l.hostWS, l.client), "", "http://localhost")
+		if err != nil {
+			fmt.Println("Can't connect to Mycel websocket server. Trying reconnect in 1 second...")
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		l.mu.Lock()
+		l.conn = conn
+		l.flush()
+		l.mu.Unlock()
+
+		l.receive(conn)
+
+		l.mu.Lock()
+		l.conn = nil
+		// The server logs off the user when the connection is lost, so make
+		// sure the user is logged on again when we reconnect.
+		if l.user != "" && !l.logOnQueued() {
+			logonMsg := logOnOffMessage{Action: "log-on", Client: l.client, User: l.user}
+			l.queue = append([]interface{}{logonMsg}, l.queue...)
+		}
+		l.mu.Unlock()
+		conn.Close()
+		println("ws disconnected")
+	}
+}
+
+// receive passes on messages from conn until the connection is lost.
+func (l *link) receive(conn *websocket.Conn) {
+	for {
+		var msg message
+		err := websocket.JSON.Receive(conn, &msg)
+		if err != nil {
+			if _, ok := err.(net.Error); ok || err == io.EOF {
+				return
+			}
+			fmt.Println("Couldn't receive msg " + err.Error())
+			continue
+		}
+		l.messages <- msg
+	}
+}
+
+// writeTimeout limits how long sending a message may take, so that a
+// connection which is silently gone doesn't block the callers of send.
+const writeTimeout = 5 * time.Second
+
+// flush sends all queued messages. l.mu must be held.
+func (l *link) flush() {
+	for l.conn != nil && len(l.queue) > 0 {
+		l.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		err := websocket.JSON.Send(l.conn, l.queue[0])
+		if err != nil {
+			fmt.Println("Couldn't send message " + err.Error())
+			// Closing makes receive return, so that we reconnect
+			l.conn.Close()
+			return
+		}
+		l.queue = l.queue[1:]
+	}
+}
+
+// logOnQueued reports whether the next message is a log-on. l.mu must be
+// held.
+func (l *link) logOnQueued() bool {
+	if len(l.queue) == 0 {
+		return false
+	}
+	msg, ok := l.queue[0].(logOnOffMessage)
+	return ok && msg.Action == "log-on"
+}
+
+// online reports whether the link is connected to the server.
+func (l *link) online() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn != nil
+}
+
+// loggedOn returns the logged on user, if any.
+func (l *link) loggedOn() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.user
+}
+
+// send queues msg, and delivers it as soon as the server can be reached.
+func (l *link) send(msg interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue = append(l.queue, msg)
+	l.flush()
+}
+
+// logOn requests the Mycel server to log on user.
+func (l *link) logOn(user string) {
+	l.mu.Lock()
+	l.user = user
+	l.mu.Unlock()
+	l.send(logOnOffMessage{Action: "log-on", Client: l.client, User: user})
+}
+
+// logOff requests the Mycel server to log off the current user.
+func (l *link) logOff() {
+	l.mu.Lock()
+	user := l.user
+	l.user = ""
+	l.mu.Unlock()
+	if user != "" {
+		l.send(logOnOffMessage{Action: "log-off", Client: l.client, User: user})
+	}
+}
+
+// close waits up to timeout for queued messages to be delivered, and then
+// closes the connection for good.
+func (l *link) close(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 || time.Now().After(deadline) {
+			break
+		}
+		l.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(l.queue) > 0 {
+		log.Printf("giving up on delivering %d messages to the Mycel server", len(l.queue))
+	}
+	l.closed = true
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mu.Unlock()
+}
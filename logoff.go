@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+
+	"github.com/digibib/mycel-client/cleanup"
+	"github.com/digibib/mycel-client/printing"
+	"github.com/digibib/mycel-client/window"
+)
+
+// cleanupStepNames lists the cleanup steps in the order they are run.
+// Processes are killed before their files are wiped, so that browsers
+// can't write back to their profiles, and media can be unmounted.
+var cleanupStepNames = []string{"clipboard", "processes", "print-queue", "files", "media"}
+
+// killGrace is how long user processes get to exit before they are killed.
+const killGrace = 5 * time.Second
+
+// cleanupMessage reports the outcome of the log-off cleanup to the Mycel
+// server.
+type cleanupMessage struct {
+	Action string           `json:"action"` // "cleanup"
+	Client int              `json:"client"`
+	User   string           `json:"user"`
+	OK     bool             `json:"ok"`
+	Steps  []cleanup.Result `json:"steps"`
+}
+
+// cleanupSteps returns the configured cleanup steps for a session. It must
+// be called after the GTK main loop has stopped.
+func cleanupSteps(cfg *config, jobs *printing.Tracker) []cleanup.Step {
+	steps := map[string]func() error{
+		"clipboard": func() error {
+			gdk.ThreadsEnter()
+			defer gdk.ThreadsLeave()
+			return window.ClearClipboard()
+		},
+		"processes": func() error {
+			return cleanup.KillSession(jobs.Since, killGrace)
+		},
+		"print-queue": func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			return jobs.CancelPending(ctx)
+		},
+		"files": func() error {
+			var failed []string
+			for _, dir := range splitList(cfg.CleanupWipe) {
+				if err := cleanup.Empty(os.ExpandEnv(dir)); err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+			for _, pair := range splitList(cfg.CleanupRestore) {
+				dirs := strings.SplitN(pair, "=", 2)
+				if err := cleanup.Restore(os.ExpandEnv(dirs[0]), dirs[1]); err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+			if len(failed) > 0 {
+				return errors.New(strings.Join(failed, "; "))
+			}
+			return nil
+		},
+		"media": func() error {
+			return cleanup.UnmountRemovable(cfg.Udisksctl)
+		},
+	}
+
+	enabled := splitList(cfg.Cleanup)
+	var list []cleanup.Step
+	for _, name := range cleanupStepNames {
+		if contains(enabled, name) {
+			list = append(list, cleanup.Step{Name: name, Run: steps[name]})
+		}
+	}
+	return list
+}
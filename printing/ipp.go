@@ -0,0 +1,151 @@
+package printing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digibib/mycel-client/ipp"
+)
+
+// ippTimeout limits how long each IPP operation may take.
+const ippTimeout = 30 * time.Second
+
+// IPP provisions printers by talking to the CUPS server over IPP, so that
+// neither sudo nor the command line tools are needed.
+type IPP struct {
+	Client *ipp.Client
+}
+
+// Install adds or modifies the queue for p.
+func (i *IPP) Install(p Printer) error {
+	args, rejected, err := lpadminArgs(p)
+	if err != nil {
+		return err
+	}
+	for _, opt := range rejected {
+		log.Printf("ignoring printer option %q for %s", opt, *p.Name)
+	}
+	attrs, err := printerAttributes(args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ippTimeout)
+	defer cancel()
+	return i.Client.AddModifyPrinter(ctx, *p.Name, attrs)
+}
+
+// Remove deletes a queue. It is not an error if it doesn't exist.
+func (i *IPP) Remove(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ippTimeout)
+	defer cancel()
+	if err := i.Client.DeletePrinter(ctx, name); err != nil && !ipp.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// SetDefault makes the named printer the default destination.
+func (i *IPP) SetDefault(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ippTimeout)
+	defer cancel()
+	return i.Client.SetDefault(ctx, name)
+}
+
+// Default returns the current default destination, if any.
+func (i *IPP) Default() string {
+	ctx, cancel := context.WithTimeout(context.Background(), ippTimeout)
+	defer cancel()
+	name, err := i.Client.Default(ctx)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// Installed returns the installed queues, mapped to their device URIs.
+func (i *IPP) Installed() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ippTimeout)
+	defer cancel()
+	return i.Client.Printers(ctx)
+}
+
+// printerAttributes translates validated lpadmin arguments into the
+// CUPS-Add-Modify-Printer attributes doing the same.
+func printerAttributes(args []string) ([]ipp.Attribute, error) {
+	var attrs []ipp.Attribute
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-E" {
+			attrs = append(attrs,
+				ipp.Boolean("printer-is-accepting-jobs", true),
+				ipp.Enum("printer-state", 3)) // idle
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, fmt.Errorf("missing value for %s", args[i])
+		}
+		v := args[i+1]
+		switch args[i] {
+		case "-p":
+		case "-m":
+			attrs = append(attrs, ipp.String(ipp.TagName, "ppd-name", v))
+		case "-v":
+			attrs = append(attrs, ipp.String(ipp.TagURI, "device-uri", v))
+		case "-L":
+			attrs = append(attrs, ipp.String(ipp.TagText, "printer-location", v))
+		case "-D":
+			attrs = append(attrs, ipp.String(ipp.TagText, "printer-info", v))
+		case "-o":
+			kv := strings.SplitN(v, "=", 2)
+			attr, err := optionAttribute(kv[0], kv[1])
+			if err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, attr)
+		default:
+			return nil, fmt.Errorf("unexpected argument %s", args[i])
+		}
+		i++
+	}
+	return attrs, nil
+}
+
+// optionAttribute translates a printer option, as given to lpadmin -o, into
+// a printer attribute. Like lpadmin, options which aren't printer
+// attributes are set as job defaults, with the "-default" suffix.
+func optionAttribute(key, value string) (ipp.Attribute, error) {
+	switch key {
+	case "printer-is-shared":
+		switch strings.ToLower(value) {
+		case "true", "yes", "on":
+			return ipp.Boolean(key, true), nil
+		}
+		return ipp.Boolean(key, false), nil
+	case "job-quota-period", "job-page-limit", "job-k-limit":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return ipp.Attribute{}, fmt.Errorf("printer option %s: %v", key, err)
+		}
+		return ipp.Integer(key, n), nil
+	case "printer-error-policy":
+		return ipp.String(ipp.TagName, key, value), nil
+	case "job-sheets-default":
+		return ipp.String(ipp.TagName, key, strings.Split(value, ",")...), nil
+	}
+	if !strings.HasSuffix(key, "-default") {
+		key += "-default"
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return ipp.Integer(key, n), nil
+	}
+	return ipp.String(ipp.TagKeyword, key, value), nil
+}
@@ -0,0 +1,43 @@
+package printing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/digibib/mycel-client/ipp"
+)
+
+func TestPrinterAttributes(t *testing.T) {
+	args, _, err := lpadminArgs(Printer{
+		Name:     str("kontor"),
+		PPD:      str("drv:///sample.drv/generic.ppd"),
+		URI:      str("socket://10.0.0.5:9100"),
+		Location: str("2. etasje"),
+		Info:     str("Skranken"),
+		Options:  str("-E -o media=A4 -o number-up=2 -o printer-is-shared=no -o job-page-limit=50 -o job-sheets-default=none,none"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := printerAttributes(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ipp.Attribute{
+		ipp.String(ipp.TagKeyword, "job-hold-until-default", "no-hold"),
+		ipp.Integer("job-page-limit", 50),
+		ipp.String(ipp.TagName, "job-sheets-default", "none", "none"),
+		ipp.String(ipp.TagKeyword, "media-default", "A4"),
+		ipp.Integer("number-up-default", 2),
+		ipp.Boolean("printer-is-shared", false),
+		ipp.Boolean("printer-is-accepting-jobs", true),
+		ipp.Enum("printer-state", 3),
+		ipp.String(ipp.TagName, "ppd-name", "drv:///sample.drv/generic.ppd"),
+		ipp.String(ipp.TagURI, "device-uri", "socket://10.0.0.5:9100"),
+		ipp.String(ipp.TagText, "printer-location", "2. etasje"),
+		ipp.String(ipp.TagText, "printer-info", "Skranken"),
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("printerAttributes(%q) =\n%+v\nwant\n%+v", args, attrs, want)
+	}
+}
@@ -0,0 +1,292 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digibib/mycel-client/ipp"
+)
+
+// TagJobs sets the job-billing option of all installed queues to user, so
+// that the jobs printed in a session can be told apart in the CUPS logs. It
+// sets the user's own defaults with lpoptions, which needs no privileges.
+// An empty user removes the option again.
+func TagJobs(a Admin, lpoptions, user string) error {
+	queues, err := a.Installed()
+	if err != nil {
+		return err
+	}
+	for name := range queues {
+		if ValidName(name) != nil {
+			continue
+		}
+		args := []string{"-p", name, "-r", "job-billing"}
+		if user != "" {
+			if err := validText(user, 255); err != nil {
+				return fmt.Errorf("invalid user name: %v", err)
+			}
+			args = []string{"-p", name, "-o", "job-billing=" + user}
+		}
+		output, err := exec.Command(lpoptions, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", filepath.Base(lpoptions), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// Job is a print job finished during a session, as reported to Mycel.
+type Job struct {
+	ID      int    `json:"id"`
+	Printer string `json:"printer"`
+	Name    string `json:"name"`
+	Pages   int    `json:"pages"`
+	State   string `json:"state"` // completed, canceled or aborted
+}
+
+// SessionJob is an unfinished print job of the session.
+type SessionJob struct {
+	ID      int
+	Printer string
+	Name    string
+	State   ipp.JobState
+	// Releasable is set for held jobs the user may release, like jobs on
+	// release printers. Jobs held for exceeding the quota are not.
+	Releasable bool
+}
+
+// Tracker follows the print jobs of a session, and enforces its page quota.
+// Jobs which would exceed the quota are held before they are printed, and
+// jobs which exceed it while printing are cancelled.
+//
+// A Tracker resumes from a saved session by setting First and Printed.
+// Poll, CancelHeld and CancelPending must be called from a single
+// goroutine; the other methods may be called from any.
+type Tracker struct {
+	Client *ipp.Client
+	Quota  *int      // pages the user may print, or nil if unlimited
+	Since  time.Time // when the session started; older jobs are ignored
+
+	// First is the lowest job id which may still be unfinished, and
+	// Printed the pages printed by finished jobs. Both are updated by Poll.
+	First   int
+	Printed int
+
+	mu       sync.Mutex
+	printing int          // pages printed so far by unfinished jobs
+	done     map[int]bool // finished jobs from First on
+	held     map[int]bool // jobs held for exceeding the quota
+	active   []ipp.Job    // unfinished jobs, as of the last Poll
+}
+
+// Jobs returns the unfinished jobs of the session, as of the last Poll.
+func (t *Tracker) Jobs() []SessionJob {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var jobs []SessionJob
+	for _, j := range t.active {
+		jobs = append(jobs, SessionJob{
+			ID:         j.ID,
+			Printer:    j.Printer,
+			Name:       j.Name,
+			State:      j.State,
+			Releasable: j.State == ipp.JobHeld && !t.held[j.ID],
+		})
+	}
+	return jobs
+}
+
+// session reports whether id is an unfinished job of the session. t.mu must
+// be held.
+func (t *Tracker) session(id int) bool {
+	for _, j := range t.active {
+		if j.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Release releases a held job of the session, unless it is held for
+// exceeding the quota.
+func (t *Tracker) Release(ctx context.Context, id int) error {
+	t.mu.Lock()
+	ok := t.session(id) && !t.held[id]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("print job %d can't be released", id)
+	}
+	return t.Client.ReleaseJob(ctx, id)
+}
+
+// Cancel cancels an unfinished job of the session.
+func (t *Tracker) Cancel(ctx context.Context, id int) error {
+	t.mu.Lock()
+	ok := t.session(id)
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("print job %d is not in the session", id)
+	}
+	return t.Client.CancelJob(ctx, id)
+}
+
+// Remaining returns the number of pages the user may still print, and
+// false if there is no quota.
+func (t *Tracker) Remaining() (pages int, limited bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Quota == nil {
+		return 0, false
+	}
+	pages = *t.Quota - t.Printed - t.printing
+	if pages < 0 {
+		pages = 0
+	}
+	return pages, true
+}
+
+// Poll checks the user's jobs, enforces the quota, and returns the jobs
+// finished since the last call.
+func (t *Tracker) Poll(ctx context.Context) ([]Job, error) {
+	jobs, err := t.Client.Jobs(ctx, t.First)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done == nil {
+		t.done = make(map[int]bool)
+		t.held = make(map[int]bool)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+
+	var finished []Job
+	var active []ipp.Job
+	next := t.First
+	for _, j := range jobs {
+		if j.ID < t.First || j.Created.Before(t.Since) || t.done[j.ID] {
+			continue
+		}
+		if j.ID >= next {
+			next = j.ID + 1
+		}
+		if !j.State.Final() {
+			active = append(active, j)
+			continue
+		}
+		t.done[j.ID] = true
+		delete(t.held, j.ID)
+		t.Printed += j.ImpressionsCompleted
+		finished = append(finished, Job{
+			ID:      j.ID,
+			Printer: j.Printer,
+			Name:    j.Name,
+			Pages:   j.ImpressionsCompleted,
+			State:   j.State.String(),
+		})
+	}
+
+	// Go through the unfinished jobs in order, and stop those which don't
+	// fit within the quota
+	t.active = active
+	t.printing = 0
+	left := -1
+	if t.Quota != nil {
+		left = *t.Quota - t.Printed
+	}
+	for i := range active {
+		j := &active[i]
+		t.printing += j.ImpressionsCompleted
+		if t.Quota == nil {
+			continue
+		}
+		switch j.State {
+		case ipp.JobProcessing, ipp.JobProcessingStopped:
+			left -= j.ImpressionsCompleted
+			if left < 0 {
+				log.Printf("cancelling print job %d, which exceeds the print quota", j.ID)
+				if err := t.Client.CancelJob(ctx, j.ID); err != nil {
+					log.Printf("failed to cancel print job %d: %v", j.ID, err)
+				}
+			}
+		case ipp.JobPending:
+			if left <= 0 || j.Impressions > left {
+				log.Printf("holding print job %d, which exceeds the print quota", j.ID)
+				if err := t.Client.HoldJob(ctx, j.ID); err != nil {
+					log.Printf("failed to hold print job %d: %v", j.ID, err)
+				} else {
+					t.held[j.ID] = true
+					j.State = ipp.JobHeld
+				}
+				continue
+			}
+			left -= j.Impressions
+		}
+	}
+
+	// Jobs before the first unfinished one need not be fetched again
+	if len(active) > 0 {
+		next = active[0].ID
+	}
+	for id := range t.done {
+		if id < next {
+			delete(t.done, id)
+		}
+	}
+	t.First = next
+	return finished, nil
+}
+
+// CancelHeld cancels the held jobs of the session when it is over, both
+// those waiting to be released and those held for exceeding the quota, so
+// that they aren't printed for the next user.
+func (t *Tracker) CancelHeld(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held := make(map[int]bool)
+	for id := range t.held {
+		held[id] = true
+	}
+	for _, j := range t.active {
+		if j.State == ipp.JobHeld {
+			held[j.ID] = true
+		}
+	}
+	for id := range held {
+		if err := t.Client.CancelJob(ctx, id); err != nil && !ipp.IsNotFound(err) {
+			log.Printf("failed to cancel held print job %d: %v", id, err)
+		}
+		delete(t.held, id)
+	}
+}
+
+// CancelPending cancels the jobs of the session which haven't started
+// printing yet, held or not, so that nothing is printed after the user has
+// left. Jobs already printing are left to finish.
+func (t *Tracker) CancelPending(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var failed []string
+	for _, j := range t.active {
+		if j.State != ipp.JobPending && j.State != ipp.JobHeld {
+			continue
+		}
+		if err := t.Client.CancelJob(ctx, j.ID); err != nil && !ipp.IsNotFound(err) {
+			failed = append(failed, fmt.Sprintf("job %d: %v", j.ID, err))
+			continue
+		}
+		delete(t.held, j.ID)
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package printing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Commands provisions printers with the CUPS command line tools. Arguments
+// are always passed as separate strings, never through a shell.
+type Commands struct {
+	Sudo      string // run the tools with sudo -n, unless empty
+	Lpadmin   string
+	Lpoptions string
+	Lpstat    string
+}
+
+// run runs a command, and returns its output in the error if it fails.
+func (c *Commands) run(name string, args ...string) error {
+	var cmd *exec.Cmd
+	if c.Sudo != "" {
+		cmd = exec.Command(c.Sudo, append([]string{"-n", name}, args...)...)
+	} else {
+		cmd = exec.Command(name, args...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", filepath.Base(name), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Install adds or modifies the queue for p.
+func (c *Commands) Install(p Printer) error {
+	args, rejected, err := lpadminArgs(p)
+	if err != nil {
+		return err
+	}
+	for _, opt := range rejected {
+		log.Printf("ignoring printer option %q for %s", opt, *p.Name)
+	}
+	return c.run(c.Lpadmin, args...)
+}
+
+// SetDefault makes the named printer the default destination.
+func (c *Commands) SetDefault(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	return c.run(c.Lpoptions, "-d", name)
+}
+
+// lpstat runs lpstat with the C locale, so that its output can be parsed.
+func (c *Commands) lpstat(args ...string) ([]byte, error) {
+	cmd := exec.Command(c.Lpstat, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd.Output()
+}
+
+// Installed returns the installed queues, mapped to their device URIs.
+func (c *Commands) Installed() (map[string]string, error) {
+	out, err := c.lpstat("-v")
+	if err != nil {
+		// lpstat fails when there are no queues at all
+		if _, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(out)) == 0 {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	queues := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		// device for NAME: URI
+		line := strings.TrimPrefix(s.Text(), "device for ")
+		if i := strings.Index(line, ": "); i > 0 && line != s.Text() {
+			queues[line[:i]] = line[i+2:]
+		}
+	}
+	return queues, s.Err()
+}
+
+// Default returns the current default destination, if any.
+func (c *Commands) Default() string {
+	out, err := c.lpstat("-d")
+	if err != nil {
+		return ""
+	}
+	const prefix = "system default destination: "
+	line := strings.TrimSpace(string(out))
+	if strings.HasPrefix(line, prefix) {
+		return strings.TrimPrefix(line, prefix)
+	}
+	return ""
+}
+
+// Remove deletes a queue.
+func (c *Commands) Remove(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	return c.run(c.Lpadmin, "-x", name)
+}
@@ -0,0 +1,220 @@
+package printing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeCommands returns Commands running the fake tools in testdata, and a
+// function returning the commands run so far, each as its name followed by
+// the arguments.
+func fakeCommands(t *testing.T, sudo bool) (*Commands, func() [][]string) {
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(t.TempDir(), "log")
+	os.Setenv("FAKE_CUPS_LOG", log)
+	t.Cleanup(func() { os.Unsetenv("FAKE_CUPS_LOG") })
+
+	c := &Commands{
+		Lpadmin:   filepath.Join(dir, "lpadmin"),
+		Lpoptions: filepath.Join(dir, "lpoptions"),
+		Lpstat:    filepath.Join(dir, "lpstat"),
+	}
+	if sudo {
+		c.Sudo = filepath.Join(dir, "sudo")
+	}
+	return c, func() [][]string {
+		b, err := ioutil.ReadFile(log)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var runs [][]string
+		for _, run := range strings.Split(strings.TrimSuffix(string(b), "\n\n"), "\n\n") {
+			runs = append(runs, strings.Split(run, "\n"))
+		}
+		return runs
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		name    string
+		printer Printer
+		want    []string
+	}{
+		{
+			name: "all settings",
+			printer: Printer{
+				Name:     str("kontor"),
+				PPD:      str("drv:///sample.drv/generic.ppd"),
+				URI:      str("ipp://printer.example/ipp/print"),
+				Location: str("2. etasje"),
+				Info:     str("Skriver ved skranken"),
+				Options:  str("-E -o media=A4 -o sides=two-sided-long-edge"),
+			},
+			want: []string{"lpadmin", "-p", "kontor",
+				"-o", "job-hold-until-default=no-hold", "-o", "media=A4", "-o", "sides=two-sided-long-edge", "-E",
+				"-m", "drv:///sample.drv/generic.ppd",
+				"-v", "ipp://printer.example/ipp/print",
+				"-L", "2. etasje",
+				"-D", "Skriver ved skranken"},
+		},
+		{
+			name: "rejected options are left out",
+			printer: Printer{
+				Name:    str("kontor"),
+				Options: str("-o media=A4 -o 'media=A4;rm -rf /' -u allow:all -o job-hold-until-default=indefinite"),
+			},
+			want: []string{"lpadmin", "-p", "kontor", "-o", "job-hold-until-default=indefinite", "-o", "media=A4"},
+		},
+		{
+			name:    "release printer",
+			printer: Printer{Name: str("kontor"), Release: true},
+			want:    []string{"lpadmin", "-p", "kontor", "-o", "job-hold-until-default=indefinite"},
+		},
+	}
+	for _, tt := range tests {
+		for _, sudo := range []bool{false, true} {
+			c, runs := fakeCommands(t, sudo)
+			if err := c.Install(tt.printer); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := runs(); !reflect.DeepEqual(got, [][]string{tt.want}) {
+				t.Errorf("%s (sudo %v): ran %q, want %q", tt.name, sudo, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestInstallInvalid(t *testing.T) {
+	printers := []Printer{
+		{},
+		{Name: str("two words")},
+		{Name: str("kontor"), URI: str("file:///etc/passwd")},
+		{Name: str("kontor"), PPD: str("-x kontor")},
+		{Name: str("kontor"), Location: str("line\nbreak")},
+		{Name: str("kontor"), Options: str("-o 'media=A4")},
+	}
+	for _, p := range printers {
+		c, runs := fakeCommands(t, false)
+		if err := c.Install(p); err == nil {
+			t.Errorf("installed invalid printer %+v", p)
+		}
+		if got := runs(); got != nil {
+			t.Errorf("ran %q for invalid printer", got)
+		}
+	}
+}
+
+func TestLegacyAndDefault(t *testing.T) {
+	c, runs := fakeCommands(t, true)
+	if err := InstallLegacy(c, "socket://10.0.0.5:9100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDefault("kontor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove("kontor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDefault("bad/name"); err == nil {
+		t.Error("accepted invalid default printer")
+	}
+	if err := InstallLegacy(c, "file:///dev/null"); err == nil {
+		t.Error("accepted invalid legacy URI")
+	}
+	want := [][]string{
+		{"lpadmin", "-p", LegacyName, "-o", "job-hold-until-default=no-hold", "-v", "socket://10.0.0.5:9100"},
+		{"lpoptions", "-d", "kontor"},
+		{"lpadmin", "-x", "kontor"},
+	}
+	if got := runs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestInstalled(t *testing.T) {
+	c, _ := fakeCommands(t, false)
+	got, err := c.Installed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"kontor":           "ipp://printer.example/ipp/print",
+		"publikumsskriver": "socket://10.0.0.5:9100",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Installed() = %v, want %v", got, want)
+	}
+	if d := c.Default(); d != "kontor" {
+		t.Errorf("Default() = %q, want kontor", d)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"kontor", "Skriver_2.etg", "blåskriver"} {
+		if err := ValidName(name); err != nil {
+			t.Errorf("ValidName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "two words", "a/b", "a#b", `a"b`, strings.Repeat("a", 128)} {
+		if ValidName(name) == nil {
+			t.Errorf("ValidName(%q) accepted", name)
+		}
+	}
+}
+
+func TestValidURI(t *testing.T) {
+	for _, uri := range []string{"ipp://printer/ipp/print", "socket://10.0.0.5:9100", "smb://server/queue", "usb://HP/LaserJet?serial=1"} {
+		if err := ValidURI(uri); err != nil {
+			t.Errorf("ValidURI(%q) = %v", uri, err)
+		}
+	}
+	for _, uri := range []string{"", "file:///etc/passwd", "ipp://printer/a b", "ipp://printer/\n", "pipe://sh"} {
+		if ValidURI(uri) == nil {
+			t.Errorf("ValidURI(%q) accepted", uri)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		options  string
+		values   map[string]string
+		enable   bool
+		rejected []string
+	}{
+		{"", map[string]string{}, false, nil},
+		{"-E -o media=A4", map[string]string{"media": "A4"}, true, nil},
+		{"-omedia=Letter -o \"sides=one-sided\"", map[string]string{"media": "Letter", "sides": "one-sided"}, false, nil},
+		{"-o device-uri=file:/tmp/x -o media=A4", map[string]string{"media": "A4"}, false, []string{"-o device-uri=file:/tmp/x"}},
+		{"-o 'media=A4 $(reboot)' -u allow:all", map[string]string{}, false, []string{"-o media=A4 $(reboot)", "-u", "allow:all"}},
+		{"-o media", map[string]string{}, false, []string{"-o media"}},
+	}
+	for _, tt := range tests {
+		opts, rejected, err := ParseOptions(tt.options)
+		if err != nil {
+			t.Errorf("ParseOptions(%q): %v", tt.options, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts.Values, tt.values) || opts.Enable != tt.enable || !reflect.DeepEqual(rejected, tt.rejected) {
+			t.Errorf("ParseOptions(%q) = %v, %v, %q; want %v, %v, %q", tt.options, opts.Values, opts.Enable, rejected, tt.values, tt.enable, tt.rejected)
+		}
+	}
+	if _, _, err := ParseOptions("-o 'media=A4"); err == nil {
+		t.Error("accepted unterminated quote")
+	}
+}
@@ -0,0 +1,149 @@
+package printing
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// allowedOptions are the printer options (lpadmin -o) that Mycel may set.
+var allowedOptions = map[string]bool{
+	"media":                    true,
+	"media-default":            true,
+	"PageSize":                 true,
+	"InputSlot":                true,
+	"sides":                    true,
+	"sides-default":            true,
+	"Duplex":                   true,
+	"ColorModel":               true,
+	"print-color-mode":         true,
+	"print-color-mode-default": true,
+	"Resolution":               true,
+	"cupsPrintQuality":         true,
+	"number-up":                true,
+	"orientation-requested":    true,
+	"fit-to-page":              true,
+	"printer-is-shared":        true,
+	"printer-error-policy":     true,
+	"job-sheets-default":       true,
+	"job-quota-period":         true,
+	"job-page-limit":           true,
+	"job-k-limit":              true,
+	"job-hold-until":           true,
+	"job-hold-until-default":   true,
+	"copies":                   true,
+	"collate":                  true,
+}
+
+// optionValue matches the option values we accept.
+var optionValue = regexp.MustCompile(`^[A-Za-z0-9_.,:+/-]{1,64}$`)
+
+// Options is a parsed, validated set of printer options.
+type Options struct {
+	// Enable is set by -E, which enables the printer and accepts jobs.
+	Enable bool
+	// Values are set with -o key=value.
+	Values map[string]string
+}
+
+// Args returns the lpadmin arguments for the options, in a stable order.
+func (o Options) Args() []string {
+	var args []string
+	keys := make([]string, 0, len(o.Values))
+	for k := range o.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-o", k+"="+o.Values[k])
+	}
+	if o.Enable {
+		args = append(args, "-E")
+	}
+	return args
+}
+
+// ParseOptions parses the printer options from Mycel, which are written as
+// lpadmin arguments, e.g. "-E -o media=A4 -o sides=two-sided-long-edge".
+// Only -E and -o with allowed option names and plain values are kept; other
+// arguments are returned in rejected. An error is only returned if the
+// options can't be parsed at all.
+func ParseOptions(s string) (opts Options, rejected []string, err error) {
+	words, err := splitWords(s)
+	if err != nil {
+		return opts, nil, err
+	}
+	opts.Values = make(map[string]string)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch {
+		case w == "-E":
+			opts.Enable = true
+		case w == "-o" && i+1 < len(words):
+			i++
+			if !opts.set(words[i]) {
+				rejected = append(rejected, "-o "+words[i])
+			}
+		case strings.HasPrefix(w, "-o") && len(w) > 2:
+			if !opts.set(w[2:]) {
+				rejected = append(rejected, w)
+			}
+		default:
+			rejected = append(rejected, w)
+		}
+	}
+	return opts, rejected, nil
+}
+
+// set stores a key=value option, if it is allowed.
+func (o *Options) set(kv string) bool {
+	i := strings.Index(kv, "=")
+	if i < 0 {
+		return false
+	}
+	key, value := kv[:i], kv[i+1:]
+	if !allowedOptions[key] || !optionValue.MatchString(value) {
+		return false
+	}
+	o.Values[key] = value
+	return true
+}
+
+// splitWords splits s into words like a shell would, honouring single and
+// double quotes, but without any expansion.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in printer options")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,168 @@
+// Package printing provisions the client's CUPS printers from the Mycel
+// printer settings.
+package printing
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// LegacyName is the queue set up from the printeraddr client option, before
+// printers were managed in Mycel.
+const LegacyName = "publikumsskriver"
+
+// Admin sets up CUPS queues. It is implemented by Commands, using the CUPS
+// command line tools, and by IPP, talking to the CUPS server directly.
+type Admin interface {
+	// Install adds or modifies the queue for p.
+	Install(p Printer) error
+	// Remove deletes the named queue.
+	Remove(name string) error
+	// SetDefault makes the named queue the default destination.
+	SetDefault(name string) error
+	// Default returns the default destination, or "" if there is none.
+	Default() string
+	// Installed returns the installed queues, mapped to their device URIs.
+	Installed() (map[string]string, error)
+}
+
+// InstallLegacy sets up the single legacy printer queue with the given
+// device URI.
+func InstallLegacy(a Admin, uri string) error {
+	if err := ValidURI(uri); err != nil {
+		return err
+	}
+	name := LegacyName
+	return a.Install(Printer{Name: &name, URI: &uri})
+}
+
+// Printer struct to match JSON response from Mycel api/clients.
+type Printer struct {
+	Id       int     `json:"id"`
+	Name     *string `json:"name"`
+	PPD      *string `json:"ppd_client"`
+	URI      *string `json:"uri_client"`
+	Location *string `json:"location"`
+	Info     *string `json:"info"`
+	Options  *string `json:"poptions"`
+	// Release holds jobs until the user releases them in the status
+	// window, so that nothing is printed by mistake.
+	Release bool `json:"print_release"`
+}
+
+// nameRegexp matches the printer names we accept. CUPS is more lenient, but
+// names should never contain spaces, slashes, quotes or '#'.
+var nameRegexp = regexp.MustCompile(`^[\p{L}\p{N}_.-]{1,127}$`)
+
+// uriSchemes are the device URI schemes we accept.
+var uriSchemes = map[string]bool{
+	"ipp": true, "ipps": true, "http": true, "https": true, "socket": true,
+	"lpd": true, "smb": true, "dnssd": true, "usb": true, "hp": true,
+}
+
+// ValidName checks a printer name.
+func ValidName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid printer name %q", name)
+	}
+	return nil
+}
+
+// ValidURI checks a printer device URI.
+func ValidURI(uri string) error {
+	if err := validText(uri, 1024); err != nil || strings.ContainsAny(uri, " \t") {
+		return fmt.Errorf("invalid printer URI %q", uri)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid printer URI %q: %v", uri, err)
+	}
+	if !uriSchemes[u.Scheme] {
+		return fmt.Errorf("printer URI scheme %q not allowed", u.Scheme)
+	}
+	return nil
+}
+
+// validModel checks a PPD file or driver name, as given to lpadmin -m.
+func validModel(model string) error {
+	if err := validText(model, 1024); err != nil || strings.ContainsAny(model, " \t") || strings.HasPrefix(model, "-") {
+		return fmt.Errorf("invalid printer model %q", model)
+	}
+	return nil
+}
+
+// validText checks free text, like a printer location or description.
+func validText(s string, max int) error {
+	if len(s) > max {
+		return errors.New("too long")
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return fmt.Errorf("invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// lpadminArgs returns the lpadmin arguments adding or modifying the queue
+// for p. Options which are not allowed are left out and returned in
+// rejected.
+func lpadminArgs(p Printer) (args []string, rejected []string, err error) {
+	if p.Name == nil {
+		return nil, nil, errors.New("printer has no name")
+	}
+	if err := ValidName(*p.Name); err != nil {
+		return nil, nil, err
+	}
+	args = []string{"-p", *p.Name}
+
+	opts := Options{Values: make(map[string]string)}
+	if p.Options != nil {
+		opts, rejected, err = ParseOptions(*p.Options)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// Release printers hold all jobs. The default is set either way, so
+	// that it is reset when a printer is no longer a release printer.
+	if p.Release {
+		opts.Values["job-hold-until-default"] = "indefinite"
+	} else if _, ok := opts.Values["job-hold-until-default"]; !ok {
+		opts.Values["job-hold-until-default"] = "no-hold"
+	}
+	args = append(args, opts.Args()...)
+
+	if p.PPD != nil {
+		if err := validModel(*p.PPD); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-m", *p.PPD)
+	}
+
+	if p.URI != nil {
+		if err := ValidURI(*p.URI); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-v", *p.URI)
+	}
+
+	if p.Location != nil {
+		if err := validText(*p.Location, 255); err != nil {
+			return nil, nil, fmt.Errorf("invalid printer location: %v", err)
+		}
+		args = append(args, "-L", *p.Location)
+	}
+
+	if p.Info != nil {
+		if err := validText(*p.Info, 255); err != nil {
+			return nil, nil, fmt.Errorf("invalid printer description: %v", err)
+		}
+		args = append(args, "-D", *p.Info)
+	}
+
+	return args, rejected, nil
+}
@@ -0,0 +1,149 @@
+package printing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/digibib/mycel-client/atomicfile"
+)
+
+// Report describes what a reconciliation changed, by printer name.
+type Report struct {
+	Added     []string          `json:"added"`
+	Updated   []string          `json:"updated"`
+	Removed   []string          `json:"removed"`
+	Unchanged []string          `json:"unchanged"`
+	Failed    map[string]string `json:"failed"`
+	Default   string            `json:"default,omitempty"`
+}
+
+// Changed reports whether anything was changed, or failed to change.
+func (r Report) Changed() bool {
+	return len(r.Added)+len(r.Updated)+len(r.Removed)+len(r.Failed) > 0
+}
+
+func (r *Report) fail(name string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]string)
+	}
+	r.Failed[name] = err.Error()
+}
+
+// fingerprint identifies the lpadmin arguments a queue was set up with.
+func fingerprint(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// readState returns the queues set up by earlier reconciliations, mapped to
+// their fingerprints.
+func readState(file string) map[string]string {
+	state := make(map[string]string)
+	if b, err := ioutil.ReadFile(file); err == nil {
+		json.Unmarshal(b, &state)
+	}
+	return state
+}
+
+func writeState(file string, state map[string]string) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(file, b, 0644)
+}
+
+// Reconcile uses a to bring the installed queues in line with printers.
+// Queues which are missing, or set up differently than last time, are
+// (re)installed, and unchanged queues are left alone. Queues earlier set up by Mycel, and the
+// legacy queue, are removed when no longer in printers. Other queues are
+// not touched. The queues set up are remembered in stateFile.
+//
+// If defaultID is not nil, the printer with that id is made the default.
+func Reconcile(a Admin, printers []Printer, defaultID *int, stateFile string) Report {
+	var report Report
+	installed, err := a.Installed()
+	if err != nil {
+		report.fail("lpstat", err)
+		installed = map[string]string{}
+	}
+	state := readState(stateFile)
+	newState := make(map[string]string)
+
+	for _, p := range printers {
+		args, _, err := lpadminArgs(p)
+		if err != nil {
+			name := "?"
+			if p.Name != nil {
+				name = *p.Name
+				// Leave the queue as it is until the settings are fixed
+				if old, ok := state[name]; ok {
+					newState[name] = old
+				}
+			}
+			report.fail(name, err)
+			continue
+		}
+		name := *p.Name
+		fp := fingerprint(args)
+
+		uri, exists := installed[name]
+		// The device URI is checked too, to catch queues changed locally
+		drifted := p.URI != nil && uri != *p.URI
+		switch {
+		case exists && state[name] == fp && !drifted:
+			report.Unchanged = append(report.Unchanged, name)
+			newState[name] = fp
+		default:
+			if err := a.Install(p); err != nil {
+				report.fail(name, err)
+				// Keep the old fingerprint, so that it is retried next time
+				if old, ok := state[name]; ok {
+					newState[name] = old
+				}
+				continue
+			}
+			if exists {
+				report.Updated = append(report.Updated, name)
+			} else {
+				report.Added = append(report.Added, name)
+			}
+			newState[name] = fp
+		}
+
+		if defaultID != nil && p.Id == *defaultID && a.Default() != name {
+			if err := a.SetDefault(name); err != nil {
+				report.fail(name, err)
+			} else {
+				report.Default = name
+			}
+		}
+	}
+
+	// Remove queues Mycel no longer manages
+	managed := map[string]bool{LegacyName: true}
+	for name := range state {
+		managed[name] = true
+	}
+	for name := range installed {
+		if _, wanted := newState[name]; wanted || !managed[name] {
+			continue
+		}
+		if err := a.Remove(name); err != nil {
+			report.fail(name, err)
+			newState[name] = state[name]
+			continue
+		}
+		report.Removed = append(report.Removed, name)
+	}
+	sort.Strings(report.Removed)
+
+	if err := writeState(stateFile, newState); err != nil {
+		report.fail("state", err)
+	}
+	return report
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digibib/mycel-client/atomicfile"
+	"github.com/digibib/mycel-client/ipp"
+	"github.com/digibib/mycel-client/printing"
+)
+
+// sessionState is the active session, as persisted to disk so that it can
+// be resumed if the client crashes or restarts.
+type sessionState struct {
+	Client   int       `json:"client"`
+	User     string    `json:"user"`
+	UserType string    `json:"user_type"`
+	Minutes  int       `json:"minutes"` // user minutes left according to the server, at Synced
+	Extra    int       `json:"extra"`
+	Synced   time.Time `json:"synced"`
+
+	// Print jobs; see printing.Tracker
+	Started    time.Time `json:"started"`
+	PrintQuota *int      `json:"print_quota"`
+	FirstJob   int       `json:"first_job"`
+	Printed    int       `json:"printed"`
+}
+
+// newSessionState captures the current state of a session.
+func newSessionState(client int, user, userType string, clock *sessionClock, jobs *printing.Tracker) sessionState {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return sessionState{
+		Client:     client,
+		User:       user,
+		UserType:   userType,
+		Minutes:    clock.minutes,
+		Extra:      clock.extra,
+		Synced:     clock.synced,
+		Started:    jobs.Since,
+		PrintQuota: jobs.Quota,
+		FirstJob:   jobs.First,
+		Printed:    jobs.Printed,
+	}
+}
+
+// clock returns a session clock which continues where the saved session
+// left off. Time passed while the client was down is counted as used.
+func (s sessionState) clock() *sessionClock {
+	return &sessionClock{minutes: s.Minutes, extra: s.Extra, synced: s.Synced}
+}
+
+// jobs returns a print job tracker which continues where the saved session
+// left off.
+func (s sessionState) jobs(client *ipp.Client) *printing.Tracker {
+	if s.Started.IsZero() {
+		// Saved before print jobs were tracked
+		s.Started = time.Now()
+	}
+	return &printing.Tracker{
+		Client:  client,
+		Quota:   s.PrintQuota,
+		Since:   s.Started,
+		First:   s.FirstJob,
+		Printed: s.Printed,
+	}
+}
+
+// readSession reads the session state from file.
+func readSession(file string) (*sessionState, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(sessionState)
+	err = json.Unmarshal(b, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// writeSession atomically writes the session state to file.
+func writeSession(file string, s sessionState) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(file, b, 0600)
+}
+
+// removeSession removes the session state file, when the session is over.
+func removeSession(file string) error {
+	err := os.Remove(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// cachePath returns the default location of a file cached by the client.
+func cachePath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "mycel-client", name)
+}
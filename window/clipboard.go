@@ -0,0 +1,20 @@
+package window
+
+import (
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gtk"
+)
+
+// ClearClipboard empties the clipboard and the primary selection, so that
+// nothing copied by one user can be pasted by the next.
+func ClearClipboard() error {
+	display := gdk.DisplayGetDefault()
+	for _, selection := range []gdk.Atom{gdk.SELECTION_CLIPBOARD, gdk.SELECTION_PRIMARY} {
+		// Taking over the selection with an empty text drops what another
+		// application owns; clearing then drops ours
+		clipboard := gtk.NewClipboardGetForDisplay(display, selection)
+		clipboard.SetText("")
+		clipboard.Clear()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package window
+
+import (
+	"time"
+
+	"github.com/mattn/go-gtk/gdkpixbuf"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// weekdays in Norwegian, indexed by time.Weekday. They are translated with
+// i18n.T.
+var weekdays = [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"}
+
+// recheckInterval is how long Closed waits before returning when the
+// opening time is unknown, so that the caller can reload opening hours.
+const recheckInterval = time.Hour
+
+// deadline calls gtk.MainQuit once t has passed, and stores true in expired.
+// The returned function must be called when the window is done, so that the
+// timer doesn't fire in a later main loop. A zero t never expires.
+func deadline(t time.Time, expired *bool) (stop func()) {
+	done := false
+	if t.IsZero() {
+		return func() {}
+	}
+	glib.TimeoutAdd(1000, func() bool {
+		if done {
+			return false
+		}
+		if !time.Now().Before(t) {
+			*expired = true
+			gtk.MainQuit()
+			return false
+		}
+		return true
+	})
+	return func() { done = true }
+}
+
+// formatOpening describes when the library opens, relative to now.
+func formatOpening(opens, now time.Time) string {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch days := int(opens.Sub(today).Hours() / 24); {
+	case days == 0:
+		return i18n.T("Åpner i dag kl. %s", opens.Format("15:04"))
+	case days == 1:
+		return i18n.T("Åpner i morgen kl. %s", opens.Format("15:04"))
+	default:
+		return i18n.T("Åpner %s kl. %s", i18n.T(weekdays[opens.Weekday()]), opens.Format("15:04"))
+	}
+}
+
+// Closed creates a GTK fullscreen window telling patrons that the library is
+// closed, and when it opens next. Nobody can log in while it is shown.
+// It returns when the opening time arrives. If opens is the zero time, the
+// opening time is unknown, and Closed returns after an hour instead.
+func Closed(client string, opens time.Time) {
+	// Inital window configuration
+	window := gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
+	defer window.Destroy()
+	window.Fullscreen()
+	window.SetKeepAbove(true)
+	window.SetTitle("Mycel Login")
+	setDirection()
+
+	// Build GUI
+	frame := gtk.NewFrame(client)
+	frame.SetLabelAlign(0.5, 0.5)
+	var imageLoader *gdkpixbuf.Loader
+	imageLoader, _ = gdkpixbuf.NewLoaderWithMimeType("image/png")
+	imageLoader.Write(logo_png())
+	imageLoader.Close()
+	logo := gtk.NewImageFromPixbuf(imageLoader.GetPixbuf())
+	info := gtk.NewLabel("")
+	info.SetMarkup("<span size='xx-large'>" + i18n.T("Biblioteket er stengt") + "</span>")
+	when := gtk.NewLabel("")
+	if opens.IsZero() {
+		opens = time.Now().Add(recheckInterval)
+	} else {
+		when.SetMarkup("<span size='large'>" + formatOpening(opens, time.Now()) + "</span>")
+	}
+
+	notices := newNoticeArea(nil)
+	vbox := gtk.NewVBox(false, 20)
+	vbox.SetBorderWidth(20)
+	vbox.Add(notices.box)
+	vbox.Add(logo)
+	vbox.Add(info)
+	vbox.Add(when)
+
+	frame.Add(vbox)
+
+	center := gtk.NewAlignment(0.5, 0.5, 0, 0)
+	center.Add(frame)
+	window.Add(center)
+
+	window.Connect("delete-event", func() bool {
+		return true
+	})
+
+	var expired bool
+	stop := deadline(opens, &expired)
+	defer stop()
+	stopNotices := notices.watch()
+	defer stopNotices()
+
+	window.ShowAll()
+	gtk.Main()
+}
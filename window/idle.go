@@ -0,0 +1,63 @@
+package window
+
+import (
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// AskPresence asks the user to confirm they are still there. Unless they do
+// within countdown, they are logged off, just like when clicking "Logg ut".
+// Nothing happens if the question is already shown.
+func (v *Status) AskPresence(countdown time.Duration) {
+	if v.presence != nil {
+		return
+	}
+	deadline := time.Now().Add(countdown)
+	md := gtk.NewMessageDialog(v.window.GetTopLevelAsWindow(), gtk.DIALOG_MODAL,
+		gtk.MESSAGE_QUESTION, gtk.BUTTONS_OK, presenceText(deadline))
+	md.SetTypeHint(gdk.WINDOW_TYPE_HINT_MENU)
+	md.SetPosition(gtk.WIN_POS_CENTER)
+	md.SetKeepAbove(true)
+	md.Connect("response", func() {
+		v.DismissPresence()
+	})
+	v.presence = md
+	md.ShowAll()
+
+	glib.TimeoutAdd(1000, func() bool {
+		// Timeouts run without the GDK lock, which the status window
+		// shares with the session goroutine
+		gdk.ThreadsEnter()
+		defer gdk.ThreadsLeave()
+		if v.presence != md {
+			// Answered or dismissed
+			return false
+		}
+		if !time.Now().Before(deadline) {
+			v.DismissPresence()
+			gtk.MainQuit()
+			return false
+		}
+		md.SetMarkup(presenceText(deadline))
+		return true
+	})
+}
+
+// DismissPresence closes the question asked by AskPresence, if shown, for
+// instance because the user is active again.
+func (v *Status) DismissPresence() {
+	if v.presence != nil {
+		v.presence.Destroy()
+		v.presence = nil
+	}
+}
+
+func presenceText(deadline time.Time) string {
+	seconds := int(time.Until(deadline).Seconds() + 0.5)
+	return i18n.T("Er du fortsatt der? Du blir logget av om %d sekunder.", seconds)
+}
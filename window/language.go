@@ -0,0 +1,41 @@
+package window
+
+import (
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// languagePicker creates a drop-down list where patrons can choose their
+// language. relabel is called when the language is changed, and should
+// update the texts of the window.
+func languagePicker(relabel func()) *gtk.ComboBoxText {
+	combo := gtk.NewComboBoxText()
+	current := i18n.Current()
+	for i, l := range i18n.Languages {
+		combo.AppendText(l.Name)
+		if l.Code == current.Code {
+			combo.SetActive(i)
+		}
+	}
+	combo.Connect("changed", func() {
+		i := combo.GetActive()
+		if i < 0 || i >= len(i18n.Languages) {
+			return
+		}
+		i18n.SetLanguage(i18n.Languages[i].Code)
+		setDirection()
+		relabel()
+	})
+	return combo
+}
+
+// setDirection lays out all windows right-to-left when the current language
+// is written that way, and left-to-right otherwise.
+func setDirection() {
+	if i18n.Current().RTL {
+		gtk.WidgetSetDefaultDirection(gtk.TEXT_DIR_RTL)
+	} else {
+		gtk.WidgetSetDefaultDirection(gtk.TEXT_DIR_LTR)
+	}
+}
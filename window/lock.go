@@ -0,0 +1,113 @@
+package window
+
+import (
+	"context"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/auth"
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// Lock covers the screen until the user unlocks it with their PIN, or logs
+// off. It is used by staff, e.g. when a patron has left without logging off.
+// Without an authenticator, as on short time clients, the user can only log
+// off. Nothing happens if the screen is already locked.
+func (v *Status) Lock(authenticator auth.Authenticator) {
+	if v.lock != nil {
+		return
+	}
+	window := gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
+	window.Fullscreen()
+	window.SetKeepAbove(true)
+	window.SetTitle("Mycel")
+	v.lock = window
+
+	info := gtk.NewLabel("")
+	info.SetMarkup("<span size='xx-large'>" + i18n.T("Skjermen er låst") + "</span>")
+	errorLabel := gtk.NewLabel("")
+	logoff := gtk.NewButtonWithLabel(i18n.T("Logg ut"))
+
+	vbox := gtk.NewVBox(false, 20)
+	vbox.SetBorderWidth(20)
+	vbox.Add(info)
+
+	finished := false
+	unlock := func() {
+		finished = true
+		window.Destroy()
+		v.lock = nil
+	}
+
+	if authenticator != nil {
+		pinentry := gtk.NewEntry()
+		pinentry.SetVisibility(false)
+		pinentry.SetMaxLength(10)
+		button := gtk.NewButtonWithLabel(i18n.T("Lås opp"))
+		hbox := gtk.NewHBox(false, 7)
+		hbox.Add(gtk.NewLabel(i18n.T("PIN-kode/passord")))
+		hbox.Add(pinentry)
+		hbox.Add(button)
+		vbox.Add(hbox)
+
+		busy := false
+		check := func() {
+			password := pinentry.GetText()
+			if busy || password == "" {
+				return
+			}
+			busy = true
+			errorLabel.SetText(i18n.T("Sjekker…"))
+
+			// Authenticate in the background, like Login
+			results := make(chan bool, 1)
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+				defer cancel()
+				user, err := authenticator.Authenticate(ctx, v.user, password)
+				results <- err == nil && user.Authenticated
+			}()
+			glib.TimeoutAdd(100, func() bool {
+				// Timeouts run without the GDK lock, which the lock
+				// window shares with the session goroutine
+				gdk.ThreadsEnter()
+				defer gdk.ThreadsLeave()
+				if finished {
+					return false
+				}
+				select {
+				case ok := <-results:
+					busy = false
+					if ok {
+						unlock()
+						return false
+					}
+					pinentry.SetText("")
+					errorLabel.SetMarkup("<span foreground='red'>" + i18n.T("Feil PIN-kode") + "</span>")
+					return false
+				default:
+					return true
+				}
+			})
+		}
+		pinentry.Connect("activate", check)
+		button.Connect("clicked", check)
+	}
+	vbox.Add(errorLabel)
+	vbox.Add(logoff)
+
+	center := gtk.NewAlignment(0.5, 0.5, 0, 0)
+	center.Add(vbox)
+	window.Add(center)
+
+	window.Connect("delete-event", func() bool {
+		return true
+	})
+	logoff.Connect("clicked", func() {
+		unlock()
+		gtk.MainQuit()
+	})
+	window.ShowAll()
+}
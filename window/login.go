@@ -1,71 +1,46 @@
 package window
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"log"
-	"net/http"
-	"net/url"
-//	"os/exec"
-	"strconv"
+	"time"
 	"unsafe"
 
 	"github.com/mattn/go-gtk/gdk"
 	"github.com/mattn/go-gtk/gdkpixbuf"
 	"github.com/mattn/go-gtk/glib"
 	"github.com/mattn/go-gtk/gtk"
-)
 
-// response struct to match JSON response from api/users/authentication
-type response struct {
-	Age           int
-	Authenticated bool
-	Message       string
-	Minutes       int
-	Type          string
-}
+	"github.com/digibib/mycel-client/auth"
+	"github.com/digibib/mycel-client/i18n"
+)
 
-// authenticate returns a user struct response from the mycel API
-// given a username and password
-func authenticate(hostAPI, username, password string) (r *response, err error) {
-	u := hostAPI + "/api/users/authenticate"
-	resp, err := http.PostForm(u, url.Values{"username": {username}, "password": {password}})
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(resp.Status)
-	}
-	r = new(response)
-	err = json.NewDecoder(resp.Body).Decode(r)
-	if err != nil {
-		return nil, err
-	}
-	return
-}
+// authTimeout limits how long to wait for the authentication backend.
+const authTimeout = 15 * time.Second
 
 // Login creates a GTK fullscreen window where users can log inn.
-// It returns when a user successfully authenticates.
-func Login(hostAPI, client string, extraMinutes, agel, ageh int) (user string, minutes int, userType string) {
+// It returns when a user successfully authenticates, or with an empty user
+// when the library closes.
+func Login(authenticator auth.Authenticator, client string, extraMinutes, agel, ageh int, closes time.Time) (user string, minutes int, userType string, printQuota *int) {
 	// Inital window configuration
 	window := gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
 	defer window.Destroy()
 	window.Fullscreen()
 	window.SetKeepAbove(true)
 	window.SetTitle("Mycel Login")
+	setDirection()
 
 	// Build GUI
-	frame := gtk.NewFrame("Logg deg på " + client)
+	frame := gtk.NewFrame("")
 	frame.SetLabelAlign(0.5, 0.5)
 	var imageLoader *gdkpixbuf.Loader
 	imageLoader, _ = gdkpixbuf.NewLoaderWithMimeType("image/png")
 	imageLoader.Write(logo_png())
 	imageLoader.Close()
 	logo := gtk.NewImageFromPixbuf(imageLoader.GetPixbuf())
-	button := gtk.NewButtonWithLabel("Logg inn")
-	userlabel := gtk.NewLabel("Lånenummer/brukernavn")
-	pinlabel := gtk.NewLabel("PIN-kode/passord")
+	button := gtk.NewButtonWithLabel("")
+	userlabel := gtk.NewLabel("")
+	pinlabel := gtk.NewLabel("")
 	table := gtk.NewTable(3, 2, false)
 	userentry := gtk.NewEntry()
 	userentry.SetMaxLength(10)
@@ -80,13 +55,32 @@ func Login(hostAPI, client string, extraMinutes, agel, ageh int) (user string, m
 	table.Attach(pinentry, 1, 2, 1, 2, gtk.FILL, gtk.FILL, 7, 5)
 	table.Attach(button, 1, 2, 2, 3, gtk.FILL, gtk.FILL, 7, 5)
 
-	error := gtk.NewLabel("")
+	errorLabel := gtk.NewLabel("")
+	spinner := gtk.NewSpinner()
+	spinner.SetNoShowAll(true)
+
+	// Set the texts in the chosen language
+	relabel := func() {
+		frame.SetLabel(i18n.T("Logg deg på %s", client))
+		button.SetLabel(i18n.T("Logg inn"))
+		userlabel.SetText(i18n.T("Lånenummer/brukernavn"))
+		pinlabel.SetText(i18n.T("PIN-kode/passord"))
+		errorLabel.SetText("")
+	}
+	relabel()
+	picker := languagePicker(relabel)
+	pickerAlign := gtk.NewAlignment(1, 0, 0, 0)
+	pickerAlign.Add(picker)
 
+	notices := newNoticeArea(nil)
 	vbox := gtk.NewVBox(false, 20)
 	vbox.SetBorderWidth(20)
+	vbox.Add(notices.box)
+	vbox.Add(pickerAlign)
 	vbox.Add(logo)
 	vbox.Add(table)
-	vbox.Add(error)
+	vbox.Add(spinner)
+	vbox.Add(errorLabel)
 
 	frame.Add(vbox)
 
@@ -94,49 +88,95 @@ func Login(hostAPI, client string, extraMinutes, agel, ageh int) (user string, m
 	center.Add(frame)
 	window.Add(center)
 
+	// busy is true while an authentication request is in flight, and
+	// finished when Login has returned
+	var busy, finished bool
+	defer func() {
+		finished = true
+	}()
+	setBusy := func(b bool) {
+		busy = b
+		userentry.SetSensitive(!b)
+		pinentry.SetSensitive(!b)
+		button.SetSensitive(!b)
+		if b {
+			errorLabel.SetMarkup(i18n.T("Sjekker…"))
+			spinner.Show()
+			spinner.Start()
+		} else {
+			spinner.Stop()
+			spinner.Hide()
+		}
+	}
+
 	// Functions to validate and check responses
-	checkResponse := func(username, password string) {
-		user, err := authenticate(hostAPI, username, password)
+	handleResponse := func(user *auth.Response, err error) {
 		if err != nil {
 			log.Println("authentication API call failed: ", err)
-			//error.SetMarkup("<span foreground='red'>Fikk ikke kontakt med server, vennligst prøv igjen!</span>")
-			error.SetMarkup("<span foreground='red'>Feil lånenummer/brukernavn eller PIN/passord</span>")
+			errorLabel.SetMarkup("<span foreground='red'>" + i18n.T("Fikk ikke kontakt med server, vennligst prøv igjen!") + "</span>")
 			return
 		}
 		if !user.Authenticated {
-			error.SetMarkup("<span foreground='red'>" + user.Message + "</span>")
+			// Messages from the backend are translated if they are known
+			errorLabel.SetMarkup("<span foreground='red'>" + i18n.T(user.Message) + "</span>")
 			return
 		}
 		if user.Minutes+extraMinutes <= 0 && user.Type != "G" {
-			error.SetMarkup("<span foreground='red'>Beklager, du har brukt opp kvoten din for i dag!</span>")
+			errorLabel.SetMarkup("<span foreground='red'>" + i18n.T("Beklager, du har brukt opp kvoten din for i dag!") + "</span>")
 			return
 		}
 		if user.Type == "G" && user.Minutes <= 0 {
-			error.SetMarkup("<span foreground='red'>Beklager, du har brukt opp kvoten din for i dag!</span>")
+			errorLabel.SetMarkup("<span foreground='red'>" + i18n.T("Beklager, du har brukt opp kvoten din for i dag!") + "</span>")
 			return
 		}
-		if user.Age < agel || user.Age > ageh {
-			error.SetMarkup("<span foreground='red'>Denne maskinen er kun for de mellom " +
-				strconv.Itoa(agel) + " og " + strconv.Itoa(ageh) + "</span>")
+		if user.Age != auth.UnknownAge && (user.Age < agel || user.Age > ageh) {
+			errorLabel.SetMarkup("<span foreground='red'>" +
+				i18n.T("Denne maskinen er kun for de mellom %d og %d", agel, ageh) + "</span>")
 			return
 		}
 
 		// sucess!
 		userType = user.Type
 		minutes = user.Minutes
-
-		// set printer billing
-		//LNUMMER
-		// Never used so disabling
-		//cmd := exec.Command("/bin/sh", "-c", "/usr/bin/lpoptions -p publikumsskriver -o job-billing="+username)
-		//output, err := cmd.CombinedOutput()
-		//if err != nil {
-		//	log.Println("failed to set printer billing options: ", string(output))
-		//}
+		printQuota = user.PrintQuota
 
 		gtk.MainQuit()
 		return
 	}
+	checkResponse := func(username, password string) {
+		if busy {
+			return
+		}
+		setBusy(true)
+
+		// Authenticate in the background, so that the window doesn't freeze
+		// while waiting for the server, and poll for the result from the
+		// GTK main loop
+		type result struct {
+			user *auth.Response
+			err  error
+		}
+		results := make(chan result, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+			defer cancel()
+			user, err := authenticator.Authenticate(ctx, username, password)
+			results <- result{user, err}
+		}()
+		glib.TimeoutAdd(100, func() bool {
+			if finished {
+				return false
+			}
+			select {
+			case r := <-results:
+				setBusy(false)
+				handleResponse(r.user, r.err)
+				return false
+			default:
+				return true
+			}
+		})
+	}
 	validate := func(ctx *glib.CallbackContext) {
 		arg := ctx.Args(0)
 		kev := *(**gdk.EventKey)(unsafe.Pointer(&arg))
@@ -166,7 +206,7 @@ func Login(hostAPI, client string, extraMinutes, agel, ageh int) (user string, m
 		username := userentry.GetText()
 		password := pinentry.GetText()
 		if (username == "") || (password == "") {
-			error.SetMarkup("<span foreground='red'>Skriv inn ditt lånenummer og PIN-kode</span>")
+			errorLabel.SetMarkup("<span foreground='red'>" + i18n.T("Skriv inn ditt lånenummer og PIN-kode") + "</span>")
 			userentry.GrabFocus()
 			return
 		}
@@ -176,8 +216,17 @@ func Login(hostAPI, client string, extraMinutes, agel, ageh int) (user string, m
 		return true
 	})
 
+	var expired bool
+	stop := deadline(closes, &expired)
+	defer stop()
+	stopNotices := notices.watch()
+	defer stopNotices()
+
 	window.ShowAll()
 	gtk.Main()
+	if expired {
+		return "", 0, "", nil
+	}
 	user = userentry.GetText()
 	return
 }
@@ -0,0 +1,179 @@
+package window
+
+import (
+	"fmt"
+	"html"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// Notice is a message from staff, like "The library closes in 15 minutes",
+// sent to one or all clients.
+type Notice struct {
+	ID       string    `json:"id"`
+	Text     string    `json:"text"`
+	Severity string    `json:"severity"` // "info", "warning" or "critical"
+	Expires  time.Time `json:"expires"`  // zero if it doesn't expire
+	Ack      bool      `json:"ack"`      // whether reading it must be confirmed
+}
+
+// severityMarkup styles the text of a notice by its severity.
+var severityMarkup = map[string]string{
+	"info":     "<span background='#e0e0e0'>%s</span>",
+	"warning":  "<span background='yellow'>%s</span>",
+	"critical": "<span background='red' foreground='white' weight='bold'>%s</span>",
+}
+
+type shownNotice struct {
+	Notice
+	acknowledged func()
+}
+
+// notices are the notices to show, on whatever screen is up. They are
+// shared, so that a notice stays until it expires or is dismissed, even if
+// the user logs in or out meanwhile.
+var notices struct {
+	sync.Mutex
+	list    []shownNotice
+	version int // counts changes to list
+}
+
+// AddNotice shows n until it expires or the user dismisses it: in the status
+// window while someone is logged in, and as a banner on the login screen
+// otherwise. If n.Ack is set, acknowledged is called when the user confirms
+// having read it. A notice replaces an earlier one with the same id.
+// AddNotice may be called from any goroutine.
+func AddNotice(n Notice, acknowledged func()) {
+	if _, ok := severityMarkup[n.Severity]; !ok {
+		n.Severity = "info"
+	}
+	notices.Lock()
+	defer notices.Unlock()
+	removeNotice(n.ID)
+	notices.list = append(notices.list, shownNotice{n, acknowledged})
+	notices.version++
+}
+
+// removeNotice removes the notice with id. notices must be locked.
+func removeNotice(id string) (removed shownNotice, ok bool) {
+	for i, n := range notices.list {
+		if n.ID == id {
+			notices.list = append(notices.list[:i], notices.list[i+1:]...)
+			notices.version++
+			return n, true
+		}
+	}
+	return shownNotice{}, false
+}
+
+// dismissNotice removes the notice with id, and reports it as acknowledged
+// if required.
+func dismissNotice(id string) {
+	notices.Lock()
+	n, ok := removeNotice(id)
+	notices.Unlock()
+	if ok && n.Ack && n.acknowledged != nil {
+		go n.acknowledged()
+	}
+}
+
+// currentNotices drops expired notices, and returns the others along with
+// the version of the list.
+func currentNotices(now time.Time) ([]Notice, int) {
+	notices.Lock()
+	defer notices.Unlock()
+	var current []Notice
+	kept := notices.list[:0]
+	for _, n := range notices.list {
+		if !n.Expires.IsZero() && !now.Before(n.Expires) {
+			notices.version++
+			continue
+		}
+		kept = append(kept, n)
+		current = append(current, n.Notice)
+	}
+	notices.list = kept
+	return current, notices.version
+}
+
+// noticeArea lists the current notices in a window, each with a button to
+// dismiss it.
+type noticeArea struct {
+	box     *gtk.VBox
+	rows    *gtk.VBox
+	version int
+	// changed is called with the number of notices shown, when it changes
+	changed func(count int)
+}
+
+func newNoticeArea(changed func(count int)) *noticeArea {
+	a := &noticeArea{box: gtk.NewVBox(false, 5), version: -1, changed: changed}
+	a.box.SetNoShowAll(true)
+	return a
+}
+
+// update lists the current notices, if they have changed since last time.
+func (a *noticeArea) update() {
+	current, version := currentNotices(time.Now())
+	if version == a.version {
+		return
+	}
+	a.version = version
+	if a.rows != nil {
+		a.rows.Destroy()
+		a.rows = nil
+	}
+	if len(current) > 0 {
+		a.rows = gtk.NewVBox(false, 5)
+		for _, n := range current {
+			label := gtk.NewLabel("")
+			label.SetLineWrap(true)
+			label.SetMarkup(fmt.Sprintf(severityMarkup[n.Severity], html.EscapeString(n.Text)))
+			button := gtk.NewButtonWithLabel(i18n.T("Lukk"))
+			if n.Ack {
+				button.SetLabel(i18n.T("Jeg har lest det"))
+			}
+			id := n.ID
+			button.Connect("clicked", func() {
+				dismissNotice(id)
+				a.update()
+			})
+			row := gtk.NewHBox(false, 7)
+			row.Add(label)
+			row.Add(button)
+			a.rows.Add(row)
+		}
+		a.box.Add(a.rows)
+		a.rows.ShowAll()
+		a.box.Show()
+	} else {
+		a.box.Hide()
+	}
+	if a.changed != nil {
+		a.changed(len(current))
+	}
+}
+
+// watch keeps the area up to date until the returned function is called.
+func (a *noticeArea) watch() (stop func()) {
+	done := false
+	a.update()
+	glib.TimeoutAdd(1000, func() bool {
+		if done {
+			return false
+		}
+		// Timeouts run without the GDK lock, which the status window
+		// shares with the session goroutine
+		gdk.ThreadsEnter()
+		a.update()
+		gdk.ThreadsLeave()
+		return true
+	})
+	return func() { done = true }
+}
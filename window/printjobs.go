@@ -0,0 +1,141 @@
+package window
+
+import (
+	"context"
+	"html"
+	"log"
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+	"github.com/digibib/mycel-client/ipp"
+	"github.com/digibib/mycel-client/printing"
+)
+
+// jobTimeout limits how long releasing or cancelling a print job may take.
+const jobTimeout = 15 * time.Second
+
+// JobControl releases and cancels the user's print jobs from the status
+// window. It is implemented by printing.Tracker.
+type JobControl interface {
+	Release(ctx context.Context, id int) error
+	Cancel(ctx context.Context, id int) error
+}
+
+// maxJobName is how much of a job name is shown in the status window.
+const maxJobName = 24
+
+// jobState describes the state of a print job to the user.
+func jobState(j printing.SessionJob) string {
+	switch {
+	case j.Releasable:
+		return i18n.T("Venter på deg")
+	case j.State == ipp.JobHeld:
+		return i18n.T("Over utskriftskvoten")
+	case j.State == ipp.JobPending:
+		return i18n.T("I kø")
+	default:
+		return i18n.T("Skrives ut")
+	}
+}
+
+// SetJobs lists the user's unfinished print jobs in the "My print jobs"
+// panel, where held jobs can be released and jobs cancelled. The panel is
+// hidden when there are no jobs.
+func (v *Status) SetJobs(jobs []printing.SessionJob) {
+	if sameJobs(jobs, v.jobs) {
+		return
+	}
+	v.jobs = jobs
+	if v.jobList != nil {
+		v.jobList.Destroy()
+		v.jobList = nil
+	}
+	if len(jobs) == 0 {
+		v.jobPanel.Hide()
+		return
+	}
+
+	v.jobList = gtk.NewVBox(false, 5)
+	for _, j := range jobs {
+		name := []rune(j.Name)
+		if len(name) > maxJobName {
+			name = append(name[:maxJobName-1], '…')
+		}
+		label := gtk.NewLabel("")
+		label.SetMarkup(html.EscapeString(string(name)) + "\n<small>" +
+			html.EscapeString(j.Printer+": "+jobState(j)) + "</small>")
+
+		row := gtk.NewHBox(false, 5)
+		row.PackStart(label, true, true, 0)
+		cancel := gtk.NewButtonWithLabel(i18n.T("Avbryt"))
+		buttons := []*gtk.Button{cancel}
+		if j.Releasable {
+			release := gtk.NewButtonWithLabel(i18n.T("Skriv ut"))
+			row.PackStart(release, false, false, 0)
+			buttons = append(buttons, release)
+			v.connectJobButton(release, buttons, j.ID, v.control.Release)
+		}
+		row.PackStart(cancel, false, false, 0)
+		v.connectJobButton(cancel, buttons, j.ID, v.control.Cancel)
+		v.jobList.PackStart(row, false, false, 0)
+	}
+	v.jobPanel.Add(v.jobList)
+	v.jobList.ShowAll()
+	v.jobPanel.Show()
+}
+
+// connectJobButton makes button do action on the job id in the background.
+// The job's buttons are disabled meanwhile; the job list is refreshed by
+// the next SetJobs. The buttons must be in the current job list.
+func (v *Status) connectJobButton(button *gtk.Button, buttons []*gtk.Button, id int, action func(context.Context, int) error) {
+	list := v.jobList
+	button.Connect("clicked", func() {
+		for _, b := range buttons {
+			b.SetSensitive(false)
+		}
+		results := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+			defer cancel()
+			results <- action(ctx, id)
+		}()
+		glib.TimeoutAdd(100, func() bool {
+			// Timeouts run without the GDK lock, which the status window
+			// shares with the session goroutine
+			gdk.ThreadsEnter()
+			defer gdk.ThreadsLeave()
+			select {
+			case err := <-results:
+				if err != nil {
+					log.Printf("failed to change print job %d: %v", id, err)
+					// Unless SetJobs has replaced the list, and destroyed
+					// the buttons, meanwhile
+					if v.jobList == list {
+						for _, b := range buttons {
+							b.SetSensitive(true)
+						}
+					}
+				}
+				return false
+			default:
+				return true
+			}
+		})
+	})
+}
+
+func sameJobs(a, b []printing.SessionJob) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -4,21 +4,25 @@ import (
 	"github.com/mattn/go-gtk/gdkpixbuf"
 	"github.com/mattn/go-gtk/gtk"
 
-	"strconv"
+	"time"
+
+	"github.com/digibib/mycel-client/i18n"
 )
 
 // ShortTime creates a GTK fullscreen window for the shorttime clients.
-// No username/password required, only click 'start' button to log in
-func ShortTime(client string, minutes int) (user string) {
+// No username/password required, only click 'start' button to log in.
+// It returns an empty user if the library closes before anyone logs in.
+func ShortTime(client string, minutes int, closes time.Time) (user string) {
 	// Inital window configuration
 	window := gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
 	defer window.Destroy()
 	window.Fullscreen()
 	window.SetKeepAbove(true)
 	window.SetTitle("Mycel Login")
+	setDirection()
 
 	// Build GUI
-	frame := gtk.NewFrame("Logg deg på " + client)
+	frame := gtk.NewFrame("")
 	frame.SetLabelAlign(0.5, 0.5)
 	var imageLoader *gdkpixbuf.Loader
 	imageLoader, _ = gdkpixbuf.NewLoaderWithMimeType("image/png")
@@ -26,12 +30,24 @@ func ShortTime(client string, minutes int) (user string) {
 	imageLoader.Close()
 	logo := gtk.NewImageFromPixbuf(imageLoader.GetPixbuf())
 	info := gtk.NewLabel("")
-	info.SetMarkup("<span foreground='red'>Dette er en korttidsmaskin\nMaks " +
-		strconv.Itoa(minutes) + " minutter!</span>")
-	button := gtk.NewButtonWithLabel("\nStart\n")
+	button := gtk.NewButtonWithLabel("")
+
+	// Set the texts in the chosen language
+	relabel := func() {
+		frame.SetLabel(i18n.T("Logg deg på %s", client))
+		info.SetMarkup("<span foreground='red'>" + i18n.T("Dette er en korttidsmaskin\nMaks %d minutter!", minutes) + "</span>")
+		button.SetLabel("\n" + i18n.T("Start") + "\n")
+	}
+	relabel()
+	picker := languagePicker(relabel)
+	pickerAlign := gtk.NewAlignment(1, 0, 0, 0)
+	pickerAlign.Add(picker)
 
+	notices := newNoticeArea(nil)
 	vbox := gtk.NewVBox(false, 20)
 	vbox.SetBorderWidth(20)
+	vbox.Add(notices.box)
+	vbox.Add(pickerAlign)
 	vbox.Add(logo)
 	vbox.Add(info)
 	vbox.Add(button)
@@ -50,7 +66,16 @@ func ShortTime(client string, minutes int) (user string) {
 		return true
 	})
 
+	var expired bool
+	stop := deadline(closes, &expired)
+	defer stop()
+	stopNotices := notices.watch()
+	defer stopNotices()
+
 	window.ShowAll()
 	gtk.Main()
+	if expired {
+		return ""
+	}
 	return "Anonym"
 }
@@ -1,33 +1,59 @@
 package window
 
 import (
-	"strconv"
+	"time"
 
 	"github.com/mattn/go-gtk/gdk"
 	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+	"github.com/digibib/mycel-client/printing"
 )
 
 // Status struct represents the status window shown when users are logged in.
 type Status struct {
-	window    *gtk.Window
-	client    string
-	user      string
-	minutes   int
-	warned    bool
-	timeLabel *gtk.Label
+	window     *gtk.Window
+	client     string
+	user       string
+	minutes    int
+	timeLabel  *gtk.Label
+	pagesLabel *gtk.Label
+	timeButton *gtk.Button
+
+	// The "My print jobs" panel; see SetJobs
+	control  JobControl
+	jobs     []printing.SessionJob
+	jobPanel *gtk.Expander
+	jobList  *gtk.VBox
+
+	// Warnings before the time runs out; see SetWarnings
+	warnings       []Warning
+	closes         time.Time
+	warnedAt       int // threshold of the last warning given, or 0
+	countdown      *gtk.Window
+	countdownLabel *gtk.Label
+
+	// The question asked when the user is idle; see AskPresence
+	presence *gtk.MessageDialog
+	// The window covering the screen while locked; see Lock
+	lock *gtk.Window
+	// Staff notices are shown in a window above this one; see AddNotice
+	noticeWindow *gtk.Window
 }
 
 // Init acts as a constructor for the Status window struct
-func (v *Status) Init(client, user string, minutes int) {
+func (v *Status) Init(client, user string, minutes int, control JobControl) {
 
 	// Initialize variables
 	v.client = client
 	v.user = user
 	v.minutes = minutes
-	v.warned = false
+	v.warnedAt = 0
+	v.control = control
 	v.window = gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
 
 	// Inital Window configuration
+	setDirection()
 	v.window.SetKeepAbove(true)
 	v.window.SetTitle(client)
 	v.window.SetTypeHint(gdk.WINDOW_TYPE_HINT_MENU)
@@ -37,13 +63,25 @@ func (v *Status) Init(client, user string, minutes int) {
 	// Build GUI
 	userLabel := gtk.NewLabel(user)
 	v.timeLabel = gtk.NewLabel("")
-	v.timeLabel.SetMarkup("<span size='xx-large'>" + strconv.Itoa(v.minutes) + " min igjen</span>")
-	button := gtk.NewButtonWithLabel("Logg ut")
+	v.timeLabel.SetMarkup("<span size='xx-large'>" + i18n.T("%d min igjen", v.minutes) + "</span>")
+	// Only shown if the user has a print quota; see SetPages
+	v.pagesLabel = gtk.NewLabel("")
+	v.pagesLabel.SetNoShowAll(true)
+	v.jobPanel = gtk.NewExpander(i18n.T("Mine utskrifter"))
+	v.jobPanel.SetExpanded(true)
+	v.jobPanel.SetNoShowAll(true)
+	// Only shown if users may ask for more time; see EnableTimeRequest
+	v.timeButton = gtk.NewButtonWithLabel(i18n.T("Be om mer tid"))
+	v.timeButton.SetNoShowAll(true)
+	button := gtk.NewButtonWithLabel(i18n.T("Logg ut"))
 
 	vbox := gtk.NewVBox(false, 20)
 	vbox.SetBorderWidth(5)
 	vbox.Add(userLabel)
 	vbox.Add(v.timeLabel)
+	vbox.Add(v.pagesLabel)
+	vbox.Add(v.jobPanel)
+	vbox.Add(v.timeButton)
 	vbox.Add(button)
 	v.window.Add(vbox)
 
@@ -56,6 +94,21 @@ func (v *Status) Init(client, user string, minutes int) {
 		gtk.MainQuit()
 	})
 
+	v.noticeWindow = gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
+	v.noticeWindow.SetKeepAbove(true)
+	v.noticeWindow.SetDecorated(false)
+	v.noticeWindow.SetTypeHint(gdk.WINDOW_TYPE_HINT_MENU)
+	v.noticeWindow.SetSizeRequest(200, -1)
+	notices := newNoticeArea(func(count int) {
+		if count > 0 {
+			v.noticeWindow.Show()
+		} else {
+			v.noticeWindow.Hide()
+		}
+	})
+	v.noticeWindow.Add(notices.box)
+	notices.watch()
+
 	return
 }
 
@@ -70,32 +123,63 @@ func (v *Status) Move() {
 	scr_w := gdk.ScreenWidth()
 	scr_h := gdk.ScreenHeight()
 	v.window.Move(scr_w-220, scr_h-220)
+	v.noticeWindow.SetGravity(gdk.GRAVITY_SOUTH_EAST)
+	v.noticeWindow.Move(scr_w-220, scr_h-410)
 	return
 }
 
+// SetMinutes shows the minutes left, and warns the user as the thresholds
+// given to SetWarnings are passed.
 func (v *Status) SetMinutes(minutes int) {
+	w, warn := v.warning(minutes)
 	var bg string
-	if minutes <= 5 {
+	if warn {
 		bg = "yellow"
 	} else {
 		bg = "#e0e0e0"
 	}
-	v.timeLabel.SetMarkup("<span background='" + bg + "' size='xx-large'>" + strconv.Itoa(minutes) + " min igjen</span>")
-
-	if minutes <= 5 && v.warned == false {
-		msg := "Du blir logget av om " + strconv.Itoa(minutes) + " minutter. Husk å lagre det du jobber med!\nLagre på USB-pinne eller send det til deg selv på epost."
-		md := gtk.NewMessageDialog(v.window.GetTopLevelAsWindow(), gtk.DIALOG_MODAL,
-			gtk.MESSAGE_WARNING, gtk.BUTTONS_OK, msg)
-		md.SetTypeHint(gdk.WINDOW_TYPE_HINT_MENU)
-		md.SetPosition(gtk.WIN_POS_CENTER)
-		md.Connect("response", func() {
-			md.Destroy()
-		})
-		md.ShowAll()
-		v.warned = true
+	v.timeLabel.SetMarkup("<span background='" + bg + "' size='xx-large'>" + i18n.T("%d min igjen", minutes) + "</span>")
+
+	switch {
+	case !warn:
+		v.warnedAt = 0
+	case v.warnedAt == 0 || w.Minutes < v.warnedAt:
+		v.warnedAt = w.Minutes
+		v.warn(w.Style, minutes)
+	case w.Minutes > v.warnedAt:
+		// The user got more time; warn again at the next threshold
+		v.warnedAt = w.Minutes
 	}
+}
 
-	if minutes > 5 {
-		v.warned = false
+// SetPages shows the number of pages the user may still print.
+func (v *Status) SetPages(pages int) {
+	markup := i18n.T("%d sider igjen å skrive ut", pages)
+	if pages <= 0 {
+		markup = "<span foreground='red'>" + markup + "</span>"
+	}
+	v.pagesLabel.SetMarkup(markup)
+	v.pagesLabel.Show()
+}
+
+// EnableTimeRequest shows the "Ask for more time" button, which calls
+// request when clicked.
+func (v *Status) EnableTimeRequest(request func()) {
+	v.timeButton.Connect("clicked", request)
+	v.timeButton.Show()
+}
+
+// SetTimeRequest updates the "Ask for more time" button: it is disabled
+// while a request is pending, and hidden when the user may not ask again.
+func (v *Status) SetTimeRequest(pending, available bool) {
+	if !available {
+		v.timeButton.Hide()
+		return
+	}
+	if pending {
+		v.timeButton.SetLabel(i18n.T("Venter på svar…"))
+	} else {
+		v.timeButton.SetLabel(i18n.T("Be om mer tid"))
 	}
+	v.timeButton.SetSensitive(!pending)
 }
@@ -0,0 +1,116 @@
+package window
+
+import (
+	"time"
+
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gtk"
+
+	"github.com/digibib/mycel-client/i18n"
+)
+
+// Warning styles. With all of them, the minutes left turn yellow.
+const (
+	WarnColour       = "colour"       // nothing more
+	WarnNotification = "notification" // a notice above the status window
+	WarnModal        = "modal"        // a dialog which must be closed
+)
+
+// Warning is given once when the minutes left reach Minutes.
+type Warning struct {
+	Minutes int
+	Style   string
+}
+
+// countdownTime is how long before the session ends the final countdown
+// covers the screen.
+const countdownTime = time.Minute
+
+// SetWarnings sets when to warn the user that the time is running out. If
+// the library closes before the user's time is up, at closes, the warnings
+// say so.
+func (v *Status) SetWarnings(warnings []Warning, closes time.Time) {
+	v.warnings = warnings
+	v.closes = closes
+}
+
+// warning returns the warning with the lowest threshold at or above minutes.
+func (v *Status) warning(minutes int) (w Warning, ok bool) {
+	for _, warning := range v.warnings {
+		if minutes <= warning.Minutes && (!ok || warning.Minutes < w.Minutes) {
+			w, ok = warning, true
+		}
+	}
+	return w, ok
+}
+
+// closing reports whether it is the library closing, rather than the user's
+// quota, that ends the session in minutes.
+func (v *Status) closing(minutes int) bool {
+	return !v.closes.IsZero() && time.Until(v.closes) <= time.Duration(minutes+1)*time.Minute
+}
+
+func (v *Status) warn(style string, minutes int) {
+	var msg string
+	if v.closing(minutes) {
+		msg = i18n.T("Biblioteket stenger om %d minutter, og da blir du logget av. Husk å lagre det du jobber med!\nLagre på USB-pinne eller send det til deg selv på epost.", minutes)
+	} else {
+		msg = i18n.T("Du blir logget av om %d minutter. Husk å lagre det du jobber med!\nLagre på USB-pinne eller send det til deg selv på epost.", minutes)
+	}
+
+	switch style {
+	case WarnNotification:
+		AddNotice(Notice{ID: "time-warning", Text: msg, Severity: "warning", Expires: time.Now().Add(time.Duration(minutes) * time.Minute)}, nil)
+	case WarnModal:
+		md := gtk.NewMessageDialog(v.window.GetTopLevelAsWindow(), gtk.DIALOG_MODAL,
+			gtk.MESSAGE_WARNING, gtk.BUTTONS_OK, msg)
+		md.SetTypeHint(gdk.WINDOW_TYPE_HINT_MENU)
+		md.SetPosition(gtk.WIN_POS_CENTER)
+		md.Connect("response", func() {
+			md.Destroy()
+		})
+		md.ShowAll()
+	}
+}
+
+// Countdown covers the screen with a countdown to end, the end of the
+// session, during its last minute. It is removed again if the user gets
+// more time. It is meant to be called every second.
+func (v *Status) Countdown(end time.Time) {
+	left := time.Until(end)
+	if left > countdownTime {
+		if v.countdown != nil {
+			v.countdown.Destroy()
+			v.countdown = nil
+		}
+		return
+	}
+
+	if v.countdown == nil {
+		v.countdown = gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
+		v.countdown.Fullscreen()
+		v.countdown.SetKeepAbove(true)
+		v.countdown.SetTitle("Mycel")
+		v.countdown.Connect("delete-event", func() bool {
+			return true
+		})
+		v.countdownLabel = gtk.NewLabel("")
+		v.countdownLabel.SetJustify(gtk.JUSTIFY_CENTER)
+		center := gtk.NewAlignment(0.5, 0.5, 0, 0)
+		center.Add(v.countdownLabel)
+		v.countdown.Add(center)
+		v.countdown.ShowAll()
+	}
+
+	seconds := int(left.Seconds() + 0.5)
+	if seconds < 0 {
+		seconds = 0
+	}
+	var msg string
+	if v.closing(1) {
+		msg = i18n.T("Biblioteket stenger.\nDu blir logget av om %d sekunder.", seconds)
+	} else {
+		msg = i18n.T("Tiden din er snart ute.\nDu blir logget av om %d sekunder.", seconds)
+	}
+	v.countdownLabel.SetMarkup("<span size='xx-large'>" + msg + "</span>")
+}